@@ -0,0 +1,103 @@
+package alloy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bertilxi/alloy/core"
+	"github.com/gin-gonic/gin"
+)
+
+// actionPropsKey is the gin context key of the props an action adds to its page's.
+const actionPropsKey = "alloy.actionProps"
+
+// ActionError fails an action with errors the page shows next to its form. The page is
+// re-rendered with status 422 and the errors as its actionErrors prop, e.g.
+// return nil, alloy.Invalid(map[string]string{"email": "Enter a valid email"}).
+type ActionError struct {
+	// Errors are passed to the page as its actionErrors prop.
+	Errors any
+}
+
+// Invalid fails an action with validation errors, such as a map of form field names to messages.
+func Invalid(errors any) *ActionError {
+	return &ActionError{Errors: errors}
+}
+
+func (e *ActionError) Error() string {
+	return "invalid form submission"
+}
+
+// Act handles a form POST to the page: it runs the page's action, then redirects or
+// renders the page with the action's data, so forms work without client JavaScript.
+func (p *Page) Act(c *gin.Context) {
+	data, err := p.Action(c)
+
+	var invalid *ActionError
+	if errors.As(err, &invalid) {
+		c.Status(http.StatusUnprocessableEntity)
+		c.Set(actionPropsKey, gin.H{"actionErrors": invalid.Errors})
+		p.render(c)
+		return
+	}
+
+	result, _ := data.(*LoaderResult)
+	if err != nil && !errors.As(err, &result) {
+		p.actionFailed(c, err)
+		return
+	}
+	if result != nil {
+		var ok bool
+		if data, ok = result.respond(c, p); !ok {
+			return
+		}
+	}
+
+	c.Set(actionPropsKey, gin.H{"actionData": data})
+	p.render(c)
+}
+
+// actionFailed responds to a failed action, through the ErrorHandler when one is set.
+func (p *Page) actionFailed(c *gin.Context, err error) {
+	if p.ErrorHandler != nil {
+		p.ErrorHandler(c, err, p)
+		return
+	}
+	renderErr := &core.RenderError{
+		Step:    "action execution",
+		Message: "Action failed",
+		Details: err.Error(),
+	}
+	p.renderFailed(c, http.StatusInternalServerError, renderErr, gin.H{
+		"error": renderErr.Error(),
+		"page":  p.Route,
+	})
+}
+
+// withActionProps adds the props set by the request's action, if any, to the page's.
+// They are merged through JSON, so the page's props must encode to an object.
+func withActionProps(c *gin.Context, props any) (any, error) {
+	extra, ok := c.Value(actionPropsKey).(gin.H)
+	if !ok {
+		return props, nil
+	}
+
+	encoded, err := json.Marshal(props)
+	if err != nil {
+		return nil, err
+	}
+	merged := map[string]json.RawMessage{}
+	if string(encoded) != "null" {
+		if err := json.Unmarshal(encoded, &merged); err != nil {
+			return nil, fmt.Errorf("props of a page with an action must be a JSON object: %w", err)
+		}
+	}
+	for key, value := range extra {
+		if merged[key], err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
@@ -4,7 +4,7 @@ import (
 	"github.com/bertilxi/alloy/core"
 )
 
-// ClearBundleCache clears the in-memory bundle cache.
+// ClearBundleCache clears the in-memory bundle cache and closes warmed SSR runtimes.
 func ClearBundleCache() {
 	core.ClearBundleCache()
 }
@@ -22,9 +22,52 @@ func (page *Page) getServerJsFromFs() (string, error) {
 	return core.GetServerBundle(reader, cacheKey)
 }
 
+func (page *Page) ssrPoolOptions() core.SSRPoolOptions {
+	return core.SSRPoolOptions{
+		Size:        page.ssrPoolSize,
+		MemoryLimit: page.RenderMemoryLimit,
+		Engine:      page.jsEngine,
+	}
+}
+
+// getRenderer returns the page's renderer: the shared worker processes when configured,
+// otherwise an in-process runtime pool.
+func (page *Page) getRenderer() (core.Renderer, error) {
+	cacheKey := core.PageCacheKey(page.File, "ssr.js")
+	if page.ssrWorkers != nil {
+		return page.ssrWorkers.Renderer(cacheKey, page.ssrPoolOptions()), nil
+	}
+	reader := page.getBundleReader()
+	return core.GetSSRPool(reader, cacheKey, page.ssrPoolOptions())
+}
+
+// mapJSError rewrites a JS exception's stack through the server bundle's source map.
+func (page *Page) mapJSError(jsErr *core.JSError) {
+	cacheKey := core.PageCacheKey(page.File, "ssr.js")
+	core.ApplySourceMap(page.getBundleReader(), cacheKey, jsErr)
+}
+
 func (page *Page) getClientJsFromFs() (string, string, error) {
 	jsCacheKey := core.PageCacheKey(page.File, "js")
 	cssCacheKey := core.PageCacheKey(page.File, "css")
 	reader := page.getBundleReader()
 	return core.GetClientBundles(reader, jsCacheKey, cssCacheKey)
 }
+
+// getClientChunksFromFs returns the keys of the shared chunks the page's client bundle imports.
+func (page *Page) getClientChunksFromFs() []string {
+	return core.GetClientChunks(page.getBundleReader(), core.PageCacheKey(page.File, "chunks.json"))
+}
+
+// getAppCSSFromFs returns the key of the stylesheet shared through _app.tsx, or "" when
+// the project has none.
+func (page *Page) getAppCSSFromFs() string {
+	if page.App == "" {
+		return ""
+	}
+	cssCacheKey := core.PageCacheKey(page.App, "css")
+	if _, err := page.getBundleReader().ReadBundle(cssCacheKey); err != nil {
+		return ""
+	}
+	return cssCacheKey
+}
@@ -0,0 +1,118 @@
+package alloy
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bertilxi/alloy/core"
+	"github.com/gin-gonic/gin"
+)
+
+const cacheTagsKey = "alloy.cacheTags"
+
+// CachePolicy caches a page's rendered document. Only 200 responses without
+// Set-Cookie are stored. Caching is bypassed in development so edits show up immediately.
+type CachePolicy struct {
+	// TTL is how long a document is served without re-running the loader and SSR.
+	TTL time.Duration
+	// StaleWhileRevalidate extends the TTL: an expired document is still served
+	// for this long while a fresh one is rendered in the background.
+	StaleWhileRevalidate time.Duration
+	// Query and Headers list the query parameters and request headers documents
+	// vary by, in addition to route params.
+	Query   []string
+	Headers []string
+	// Key replaces the default key built from route params, Query and Headers.
+	Key func(c *gin.Context) string
+	// Tags are attached to every document of the page, for PurgeTag. Loaders can add
+	// more per document with CacheTags.
+	Tags []string
+}
+
+// CacheTags tags the document being rendered for c, so Engine.PurgeTag can drop it.
+// Call it from a loader.
+func CacheTags(c *gin.Context, tags ...string) {
+	existing, _ := c.Get(cacheTagsKey)
+	current, _ := existing.([]string)
+	c.Set(cacheTagsKey, append(current, tags...))
+}
+
+// PurgeRoute drops every cached document of the page at route (the route pattern, e.g. "/blog/:slug").
+func (engine *Engine) PurgeRoute(route string) {
+	engine.PageStore.PurgeRoute(route)
+}
+
+// PurgeTag drops every cached document tagged with tag.
+func (engine *Engine) PurgeTag(tag string) {
+	engine.PageStore.PurgeTag(tag)
+}
+
+// renderCached serves c from the page store, rendering on a miss and revalidating
+// stale documents in the background.
+func (p *Page) renderCached(c *gin.Context) {
+	key := p.Route
+	if p.Cache.Key != nil {
+		key += "\x00" + p.Cache.Key(c)
+	} else {
+		key = varyKey(p.Route, c, p.Cache.Query, p.Cache.Headers)
+	}
+
+	if cached, ok := p.pageStore.Get(key); ok {
+		now := time.Now()
+		if now.Before(cached.FreshUntil) {
+			writeCachedPage(c, cached, "HIT")
+			return
+		}
+		if now.Before(cached.StaleUntil) {
+			// Revalidation shares the flight with any concurrent miss for the key.
+			p.renderShared(c, key, p.storeFunc(key))
+			writeCachedPage(c, cached, "STALE")
+			return
+		}
+	}
+
+	select {
+	case res := <-p.renderShared(c, key, p.storeFunc(key)):
+		c.Header("X-Alloy-Cache", "MISS")
+		p.writeShared(c, res.Val.(*recordedResponse))
+	case <-c.Request.Context().Done():
+		c.Abort()
+	}
+}
+
+// storeFunc returns the callback that stores a freshly rendered document under key.
+func (p *Page) storeFunc(key string) func(rc *gin.Context, response *recordedResponse) {
+	return func(rc *gin.Context, response *recordedResponse) {
+		if response.status != http.StatusOK || response.header.Get("Set-Cookie") != "" {
+			return
+		}
+
+		tags := append([]string(nil), p.Cache.Tags...)
+		if extra, ok := rc.Get(cacheTagsKey); ok {
+			tags = append(tags, extra.([]string)...)
+		}
+
+		now := time.Now()
+		p.pageStore.Set(key, &core.CachedPage{
+			Route:      p.Route,
+			Tags:       tags,
+			Status:     response.status,
+			Header:     response.header,
+			Body:       response.body,
+			StoredAt:   now,
+			FreshUntil: now.Add(p.Cache.TTL),
+			StaleUntil: now.Add(p.Cache.TTL + p.Cache.StaleWhileRevalidate),
+		})
+	}
+}
+
+func writeCachedPage(c *gin.Context, cached *core.CachedPage, state string) {
+	for key, values := range cached.Header {
+		c.Writer.Header()[key] = append([]string(nil), values...)
+	}
+	c.Header("X-Alloy-Cache", state)
+	c.Header("Age", strconv.Itoa(int(time.Since(cached.StoredAt).Seconds())))
+	c.Status(cached.Status)
+	c.Writer.Write(cached.Body)
+}
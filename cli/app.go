@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bertilxi/alloy"
+	"github.com/bertilxi/alloy/core"
+	esbuild "github.com/evanw/esbuild/pkg/api"
+)
+
+// appStyles are the stylesheets _app.tsx imports, directly or through its components.
+// They are served once for every page from the app's stylesheet, so the pages' build
+// leaves them out.
+type appStyles struct {
+	mu    sync.RWMutex
+	files map[string]bool
+	// onChange is called when a rebuild of the app imports other stylesheets.
+	onChange func()
+}
+
+func (s *appStyles) contains(file string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.files[file]
+}
+
+// set replaces the app's stylesheets and reports whether they changed.
+func (s *appStyles) set(files map[string]bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if maps.Equal(s.files, files) {
+		return false
+	}
+	s.files = files
+	return true
+}
+
+// plugin leaves the app's stylesheets out of a page's client bundle.
+func (s *appStyles) plugin() esbuild.Plugin {
+	return esbuild.Plugin{
+		Name: "alloy-app-styles",
+		Setup: func(build esbuild.PluginBuild) {
+			build.OnResolve(esbuild.OnResolveOptions{Filter: `\.css$`, Namespace: "file"}, func(args esbuild.OnResolveArgs) (esbuild.OnResolveResult, error) {
+				file := args.Path
+				if !filepath.IsAbs(file) {
+					if !strings.HasPrefix(file, ".") {
+						return esbuild.OnResolveResult{}, nil
+					}
+					file = filepath.Join(args.ResolveDir, file)
+				}
+				if !s.contains(file) {
+					return esbuild.OnResolveResult{}, nil
+				}
+				return esbuild.OnResolveResult{Path: file, Namespace: "alloy-app-styles"}, nil
+			})
+			build.OnLoad(esbuild.OnLoadOptions{Filter: `.*`, Namespace: "alloy-app-styles"}, func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+				contents := ""
+				return esbuild.OnLoadResult{Contents: &contents, Loader: esbuild.LoaderEmpty}, nil
+			})
+		},
+	}
+}
+
+// appBundler builds the stylesheet of the project's _app.tsx. Only the CSS is written:
+// the app's scripts are part of every page's client bundle.
+type appBundler struct {
+	file   string
+	styles *appStyles
+}
+
+// newAppBundler returns a bundler for the project's _app.tsx, or nil if it has none.
+func newAppBundler(pages []alloy.Page) *appBundler {
+	for _, page := range pages {
+		if page.App != "" {
+			return &appBundler{file: page.App, styles: &appStyles{}}
+		}
+	}
+	return nil
+}
+
+func (b *appBundler) options() esbuild.BuildOptions {
+	outfile := strings.TrimSuffix(path.Join(core.CacheDir, filepath.ToSlash(b.file)), filepath.Ext(b.file)) + ".js"
+
+	return esbuild.BuildOptions{
+		EntryPoints:       []string{b.file},
+		Outfile:           outfile,
+		Format:            esbuild.FormatESModule,
+		Platform:          esbuild.PlatformBrowser,
+		Target:            esbuild.ES2020,
+		Loader:            clientLoaderMap,
+		Bundle:            true,
+		Write:             false,
+		Metafile:          true,
+		MinifyWhitespace:  core.IsProd(),
+		MinifyIdentifiers: core.IsProd(),
+		MinifySyntax:      core.IsProd(),
+		Sourcemap:         getSourcemapMode(),
+		Plugins: []esbuild.Plugin{
+			runtimePlugin(),
+			newTailwindPlugin(core.IsProd(), false), // disable caching in dev for hot reload
+			b.outputPlugin(),
+		},
+	}
+}
+
+// outputPlugin writes the app's stylesheet and records the stylesheets it imports.
+func (b *appBundler) outputPlugin() esbuild.Plugin {
+	return esbuild.Plugin{
+		Name: "alloy-app-output",
+		Setup: func(build esbuild.PluginBuild) {
+			build.OnEnd(func(result *esbuild.BuildResult) (esbuild.OnEndResult, error) {
+				if len(result.Errors) > 0 {
+					return esbuild.OnEndResult{}, nil
+				}
+				for _, file := range result.OutputFiles {
+					if !strings.HasSuffix(file.Path, ".css") && !strings.HasSuffix(file.Path, ".css.map") {
+						continue
+					}
+					if err := os.MkdirAll(filepath.Dir(file.Path), 0755); err != nil {
+						return esbuild.OnEndResult{}, err
+					}
+					if err := os.WriteFile(file.Path, file.Contents, 0644); err != nil {
+						return esbuild.OnEndResult{}, err
+					}
+				}
+
+				files, err := metafileStyles(result.Metafile)
+				if err != nil {
+					return esbuild.OnEndResult{}, err
+				}
+				if b.styles.set(files) && b.styles.onChange != nil {
+					go b.styles.onChange()
+				}
+				return esbuild.OnEndResult{}, nil
+			})
+		},
+	}
+}
+
+// metafileStyles returns the absolute paths of the stylesheets among a build's inputs.
+// Tailwind's processed copies are mapped back to the stylesheets they come from.
+func metafileStyles(metafile string) (map[string]bool, error) {
+	var meta struct {
+		Inputs map[string]json.RawMessage `json:"inputs"`
+	}
+	if err := json.Unmarshal([]byte(metafile), &meta); err != nil {
+		return nil, fmt.Errorf("failed to read app metafile: %w", err)
+	}
+
+	files := map[string]bool{}
+	for input := range meta.Inputs {
+		if !strings.HasSuffix(input, ".css") || strings.Contains(input, ":") {
+			continue
+		}
+		input = filepath.FromSlash(input)
+		if rel, ok := strings.CutPrefix(input, core.CacheDir+string(filepath.Separator)); ok && strings.HasSuffix(rel, ".tmp.css") {
+			input = strings.TrimSuffix(rel, ".tmp.css") + ".css"
+		}
+		file, err := filepath.Abs(input)
+		if err != nil {
+			return nil, err
+		}
+		files[file] = true
+	}
+	return files, nil
+}
+
+func (b *appBundler) build() error {
+	result := esbuild.Build(b.options())
+
+	if len(result.Errors) > 0 {
+		errorMsg := formatBuildErrors(result.Errors)
+		context := ExtractBuildErrorContext(errorMsg)
+		return fmt.Errorf("app bundle error: %s", context)
+	}
+	return nil
+}
+
+func (b *appBundler) watch() error {
+	ctx, err := esbuild.Context(b.options())
+	if err != nil {
+		return err
+	}
+	return ctx.Watch(esbuild.WatchOptions{})
+}
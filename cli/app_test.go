@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bertilxi/alloy"
+	"github.com/bertilxi/alloy/core"
+)
+
+func TestAppBundler(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeReactStubs(t)
+	writeFiles(t, map[string]string{
+		"components/Shell.tsx": `import "./shell.css"; export default function Shell({ children }) { return <main>{children}</main>; }`,
+		"components/shell.css": `.shell { color: red; }`,
+		"pages/_app.tsx":       `import "./global.css"; import Shell from "../components/Shell"; export default function App({ Component, pageProps }) { return <Shell><Component {...pageProps} /></Shell>; }`,
+		"pages/global.css":     `body { margin: 0; }`,
+		"pages/index.tsx":      `import "../components/shell.css"; import "./index.css"; export default function Index() { return <div />; }`,
+		"pages/index.css":      `h1 { color: blue; }`,
+	})
+
+	pages, err := alloy.DiscoverPages("pages", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := newAppBundler(pages)
+	if app == nil {
+		t.Fatal("expected an app bundler for pages/_app.tsx")
+	}
+	if err := app.build(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stylesheets the app imports through its components count too.
+	for _, file := range []string{"pages/global.css", "components/shell.css"} {
+		absFile, _ := filepath.Abs(file)
+		if !app.styles.contains(absFile) {
+			t.Errorf("expected %s among the app's stylesheets, got %v", file, app.styles.files)
+		}
+	}
+
+	// Only the app's stylesheet is written; its scripts ship in the pages' bundles.
+	appCSS, err := os.ReadFile(core.PageCacheKey("pages/_app.tsx", "css"))
+	if err != nil || !strings.Contains(string(appCSS), ".shell") || !strings.Contains(string(appCSS), "margin: 0") {
+		t.Fatalf("expected the app's stylesheet, got %q, %v", appCSS, err)
+	}
+	if _, err := os.Stat(core.PageCacheKey("pages/_app.tsx", "js")); err == nil {
+		t.Fatal("expected no script for _app.tsx")
+	}
+
+	// Pages leave out what the app's stylesheet already has.
+	if err := newClientBundler(pages, app.styles).build(); err != nil {
+		t.Fatal(err)
+	}
+	indexCSS, err := os.ReadFile(core.PageCacheKey("pages/index.tsx", "css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(indexCSS), ".shell") || !strings.Contains(string(indexCSS), "color: blue") {
+		t.Fatalf("expected only the page's own styles, got %q", indexCSS)
+	}
+}
@@ -3,6 +3,7 @@ package cli
 import (
 	"fmt"
 	"os"
+	"slices"
 	"sync"
 
 	"github.com/bertilxi/alloy"
@@ -44,15 +45,50 @@ func Build(engine *alloy.Engine) error {
 		return fmt.Errorf("failed to clean cache: %w", err)
 	}
 
+	if doc := documentBundler(engine.Options.PagesDir); doc != nil {
+		PrintPageBuildStart("document", doc.page.File)
+		if _, err := doc.buildBackend(); err != nil {
+			PrintPageBuildError("document", doc.page.File, err)
+			return fmt.Errorf("failed to build %s: %w", doc.page.File, err)
+		}
+		PrintPageBuildComplete("document")
+	}
+
+	// The app is built first, so the pages' build knows which stylesheets it ships.
+	var styles *appStyles
+	if app := newAppBundler(engine.Pages); app != nil {
+		PrintPageBuildStart("app", app.file)
+		if err := app.build(); err != nil {
+			PrintPageBuildError("app", app.file, err)
+			return fmt.Errorf("failed to build %s: %w", app.file, err)
+		}
+		PrintPageBuildComplete("app")
+		styles = app.styles
+	}
+
+	islands, err := newIslandsBundler(engine.Options.PagesDir)
+	if err != nil {
+		return err
+	}
+	if islands != nil {
+		PrintPageBuildStart("islands", islandsDir)
+		if err := islands.build(); err != nil {
+			PrintPageBuildError("islands", islandsDir, err)
+			return fmt.Errorf("failed to build islands: %w", err)
+		}
+		PrintPageBuildComplete("islands")
+	}
+
 	type buildResult struct {
 		page alloy.Page
 		err  error
 	}
 
-	resultsCh := make(chan buildResult, len(engine.Pages))
+	pages = bundledPages(engine)
+	resultsCh := make(chan buildResult, len(pages))
 	var wg sync.WaitGroup
 
-	for _, page := range engine.Pages {
+	for _, page := range pages {
 		wg.Add(1)
 		go func(p alloy.Page) {
 			defer wg.Done()
@@ -68,13 +104,6 @@ func Build(engine *alloy.Engine) error {
 				return
 			}
 
-			_, _, clientErr := bundler.buildClient()
-			if clientErr != nil {
-				PrintPageBuildError(p.Route, p.File, clientErr)
-				resultsCh <- buildResult{page: p, err: clientErr}
-				return
-			}
-
 			PrintPageBuildComplete(p.Route)
 			resultsCh <- buildResult{page: p, err: nil}
 		}(page)
@@ -91,10 +120,58 @@ func Build(engine *alloy.Engine) error {
 	}
 
 	if failedCount > 0 {
-		PrintBuildFailed(failedCount, len(engine.Pages))
+		PrintBuildFailed(failedCount, len(pages))
 		return fmt.Errorf("failed to build %d pages", failedCount)
 	}
 
+	// Client entries are built together so pages share React and common modules.
+	PrintPageBuildStart("client", core.CacheDir)
+	if err := newClientBundler(pages, styles).build(); err != nil {
+		PrintPageBuildError("client", core.CacheDir, err)
+		PrintBuildFailed(len(pages), len(pages))
+		return fmt.Errorf("failed to build client bundles: %w", err)
+	}
+	PrintPageBuildComplete("client")
+
+	if err := prerenderPages(engine); err != nil {
+		return err
+	}
+
 	PrintBuildComplete(len(engine.Pages), warnings)
 	return nil
 }
+
+// bundledPages lists the pages to bundle: every route plus pages/404.tsx and
+// pages/_error.tsx.
+func bundledPages(engine *alloy.Engine) []alloy.Page {
+	pages := slices.Clone(engine.Pages)
+	if notFoundPage := alloy.DiscoverNotFoundPage(engine.Options.PagesDir, engine.Options.Loaders); notFoundPage != nil {
+		pages = append(pages, *notFoundPage)
+	}
+	if errorPage := alloy.DiscoverErrorPage(engine.Options.PagesDir, engine.Options.Loaders); errorPage != nil {
+		pages = append(pages, *errorPage)
+	}
+	return pages
+}
+
+// prerenderPages stores the documents of pages that render the same for every request,
+// so the production server can serve them without running the JS runtime.
+func prerenderPages(engine *alloy.Engine) error {
+	// Render from the bundles just built, not an embedded copy that predates them.
+	options := engine.Options
+	options.EmbedFS = nil
+
+	for _, page := range engine.Pages {
+		page.AssignOptions(options)
+		if !page.Prerenderable() {
+			continue
+		}
+
+		if err := page.WritePrerendered(); err != nil {
+			PrintPageBuildError(page.Route, page.File, err)
+			return fmt.Errorf("failed to prerender %s: %w", page.Route, err)
+		}
+		fmt.Printf("✓ %s prerendered\n", page.Route)
+	}
+	return nil
+}
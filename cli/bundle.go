@@ -1,41 +1,187 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/bertilxi/alloy"
 	"github.com/bertilxi/alloy/core"
 	esbuild "github.com/evanw/esbuild/pkg/api"
 )
 
-// [Yaffle/TextEncoderTextDecoder.js](https://gist.github.com/Yaffle/5458286)
-const textEncoderPolyfill = `function TextEncoder(){}function TextDecoder(){}TextEncoder.prototype.encode=function(e){for(var o=[],t=e.length,r=0;r<t;){var n=e.codePointAt(r),c=0,f=0;for(n<=127?(c=0,f=0):n<=2047?(c=6,f=192):n<=65535?(c=12,f=224):n<=2097151&&(c=18,f=240),o.push(f|n>>c),c-=6;c>=0;)o.push(128|n>>c&63),c-=6;r+=n>=65536?2:1}return o},TextDecoder.prototype.decode=function(e){for(var o="",t=0;t<e.length;){var r=e[t],n=0,c=0;if(r<=127?(n=0,c=255&r):r<=223?(n=1,c=31&r):r<=239?(n=2,c=15&r):r<=244&&(n=3,c=7&r),e.length-t-n>0)for(var f=0;f<n;)c=c<<6|63&(r=e[t+f+1]),f+=1;else c=65533,n=e.length-t;o+=String.fromCodePoint(c),t+=n+1}return o};`
-const consolePolyfill = `var console={log:function(){},error:function(){}};`
+// [Yaffle/TextEncoderTextDecoder.js](https://gist.github.com/Yaffle/5458286), installed
+// only where the runtime has no TextEncoder/TextDecoder of its own.
+const textEncoderPolyfill = `(function(){function TextEncoder(){}function TextDecoder(){}TextEncoder.prototype.encode=function(e){for(var o=[],t=e.length,r=0;r<t;){var n=e.codePointAt(r),c=0,f=0;for(n<=127?(c=0,f=0):n<=2047?(c=6,f=192):n<=65535?(c=12,f=224):n<=2097151&&(c=18,f=240),o.push(f|n>>c),c-=6;c>=0;)o.push(128|n>>c&63),c-=6;r+=n>=65536?2:1}return o},TextDecoder.prototype.decode=function(e){for(var o="",t=0;t<e.length;){var r=e[t],n=0,c=0;if(r<=127?(n=0,c=255&r):r<=223?(n=1,c=31&r):r<=239?(n=2,c=15&r):r<=244&&(n=3,c=7&r),e.length-t-n>0)for(var f=0;f<n;)c=c<<6|63&(r=e[t+f+1]),f+=1;else c=65533,n=e.length-t;o+=String.fromCodePoint(c),t+=n+1}return o};if(typeof globalThis.TextEncoder==="undefined")globalThis.TextEncoder=TextEncoder;if(typeof globalThis.TextDecoder==="undefined")globalThis.TextDecoder=TextDecoder})();`
+
+// Keeps the native console the SSR runtime installs (forwarded to slog); the no-op
+// fallback only applies where no console exists.
+const consolePolyfill = `var console=globalThis.console||{log:function(){},info:function(){},warn:function(){},error:function(){},debug:function(){}};`
+
+// Minimal queueMicrotask, performance, TextEncoder.encodeInto and ReadableStream shims so
+// react-dom/server.edge's renderToReadableStream can run inside QuickJS. A native
+// TextEncoder, which has encodeInto, is left alone.
+const streamPolyfill = `if(typeof queueMicrotask!=="function"){globalThis.queueMicrotask=function(cb){Promise.resolve().then(cb)}}if(typeof performance==="undefined"){globalThis.performance={now:function(){return Date.now()}}}if(!TextEncoder.prototype.encodeInto)(function(){var encode=TextEncoder.prototype.encode;TextEncoder.prototype.encode=function(s){return new Uint8Array(encode.call(this,s===undefined?"":String(s)))};TextEncoder.prototype.encodeInto=function(s,dest){var read=0,written=0;while(read<s.length){var cp=s.codePointAt(read),size=cp<=127?1:cp<=2047?2:cp<=65535?3:4;if(written+size>dest.length)break;dest.set(encode.call(this,String.fromCodePoint(cp)),written);written+=size;read+=cp>=65536?2:1}return{read:read,written:written}}})();if(typeof ReadableStream==="undefined"){globalThis.ReadableStream=function(source){var queue=[],waiting=[],closed=false,failure=null,pulling=false;function settle(){while(waiting.length){var w=waiting.shift();if(queue.length)w.resolve({done:false,value:queue.shift()});else if(failure)w.reject(failure);else if(closed)w.resolve({done:true,value:undefined});else{waiting.unshift(w);return}}}var controller={desiredSize:0,byobRequest:null,enqueue:function(chunk){queue.push(chunk);settle()},close:function(){closed=true;settle()},error:function(e){failure=e;settle()}};function pull(){if(pulling||!source.pull||closed||failure)return;pulling=true;Promise.resolve(source.pull(controller)).then(function(){pulling=false},function(e){pulling=false;controller.error(e)})}this.getReader=function(){return{read:function(){return new Promise(function(resolve,reject){waiting.push({resolve:resolve,reject:reject});settle();if(waiting.length)pull()})},releaseLock:function(){},cancel:function(reason){closed=true;if(source.cancel)source.cancel(reason);settle();return Promise.resolve()}}};if(source.start)source.start(controller)}}`
 
 const serverEntry = `import React from "react";
-import { renderToString } from "react-dom/server.edge";
+import { renderToString, renderToStaticMarkup, renderToReadableStream } from "react-dom/server.edge";
+import { HeadProvider, RequestProvider, headElements } from "alloy";
 import Page from "./$page";
+$imports
+function Content(props) {
+  return $content;
+}
+
+function Root(props) {
+  return $root;
+}
+
+function renderHead(collected) {
+  return renderToStaticMarkup(<>{headElements(collected)}</>);
+}
+
+function ServerRoot(props) {
+  return (
+    <RequestProvider value={props.context}>
+      <HeadProvider collector={props.head}>
+        <Root {...props.props} />
+      </HeadProvider>
+    </RequestProvider>
+  );
+}
 
-globalThis.renderPage = function renderPage(props) {
-  return renderToString(<Page {...props} />);
+globalThis.renderPage = function renderPage(props, context) {
+  const head = [];
+  const html = renderToString(<ServerRoot props={props} context={context} head={head} />);
+  return { html, head: renderHead(head) };
+}
+
+globalThis.renderPageStream = async function renderPageStream(props, write, context) {
+  const head = [];
+  const stream = await renderToReadableStream(<ServerRoot props={props} context={context} head={head} />, {
+    onError(error) {
+      console.error(error);
+    },
+  });
+  // The shell is ready, so its Heads have rendered. Their markup goes first, for the
+  // server to place in the document head.
+  write(new TextEncoder().encode("<!--alloy:head-->" + renderHead(head)));
+  const reader = stream.getReader();
+  while (true) {
+    const { done, value } = await reader.read();
+    if (done) {
+      return;
+    }
+    write(value);
+  }
+}`
+
+// documentEntry renders _document.tsx once into a shell whose slots are placeholders
+// the server turns into template actions. lang and className are template actions too.
+const documentEntry = `import React from "react";
+import { renderToStaticMarkup } from "react-dom/server.edge";
+import Document from "./$page";
+
+globalThis.renderPage = function renderPage() {
+  return renderToStaticMarkup(
+    <Document
+      lang="{{.Lang}}"
+      className="{{.Class}}"
+      head={<alloy-slot name="head" />}
+      content={<alloy-slot name="content" />}
+      scripts={<alloy-slot name="scripts" />}
+      devReload={<alloy-slot name="devReload" />}
+    />
+  );
 }`
 
 const clientEntry = `import React from 'react';
 import ReactDOM from 'react-dom/client';
+import { mount } from 'alloy/client';
 import Page from './$page';
+$imports
+function Content(props) {
+  return $content;
+}
+
+function Root(props) {
+  return $root;
+}
 
-const root = ReactDOM.hydrateRoot(
-    document.getElementById('page'),
-    <Page {...(window.PAGE_PROPS || {})} />
-);`
+// Hydrates the page on first load; the client router calls render after navigating here.
+export const render = mount(ReactDOM, Root);`
 
 type bundler struct {
 	page *alloy.Page
 }
 
+// documentBundler returns a bundler for the app's _document.tsx, or nil if it has none.
+// Only its server bundle is built.
+func documentBundler(pagesDir string) *bundler {
+	file := filepath.Join(pagesDir, core.DocumentFile)
+	if _, err := os.Stat(file); err != nil {
+		return nil
+	}
+	return &bundler{page: &alloy.Page{File: file}}
+}
+
+func (b *bundler) serverEntry() string {
+	if filepath.Base(b.page.File) == core.DocumentFile {
+		return documentEntry
+	}
+	return serverEntry
+}
+
+// entryContents fills an entry template for the page, composing its layouts
+// outermost-first around it and wrapping the result in _app.tsx. With layouts, props
+// are {page, layouts} and each component gets its own share.
+func (b *bundler) entryContents(entry string) string {
+	pagePath, _ := filepath.Abs(b.page.File)
+	pageDir := filepath.Dir(pagePath)
+
+	var imports, opening, closing strings.Builder
+	content := "<Page {...props} />"
+	if len(b.page.Layouts) > 0 {
+		for i, layout := range b.page.Layouts {
+			fmt.Fprintf(&imports, "import Layout%d from %q;\n", i, importPath(pageDir, layout.File))
+			fmt.Fprintf(&opening, "<Layout%d {...props.layouts[%d]}>", i, i)
+			fmt.Fprintf(&closing, "</Layout%d>", len(b.page.Layouts)-1-i)
+		}
+		content = opening.String() + "<Page {...props.page} />" + closing.String()
+	}
+
+	root := "<Content {...props} />"
+	if b.page.App != "" {
+		fmt.Fprintf(&imports, "import App from %q;\n", importPath(pageDir, b.page.App))
+		root = "<App Component={Content} pageProps={props} />"
+	}
+
+	return strings.NewReplacer(
+		"$page", filepath.Base(pagePath),
+		"$imports", imports.String(),
+		"$content", content,
+		"$root", root,
+	).Replace(entry)
+}
+
+// importPath returns the import specifier of file from dir.
+func importPath(dir, file string) string {
+	absFile, _ := filepath.Abs(file)
+	rel, err := filepath.Rel(dir, absFile)
+	if err != nil {
+		return filepath.ToSlash(absFile)
+	}
+	rel = filepath.ToSlash(rel)
+	if !strings.HasPrefix(rel, ".") {
+		rel = "./" + rel
+	}
+	return rel
+}
+
 func formatBuildErrors(errors []esbuild.Message) string {
 	if len(errors) == 0 {
 		return "unknown error"
@@ -70,7 +216,6 @@ func getSourcemapMode() esbuild.SourceMap {
 func (b *bundler) backendOptions() esbuild.BuildOptions {
 	pagePath, _ := filepath.Abs(b.page.File)
 	pageDir := filepath.Dir(pagePath)
-	pageName := filepath.Base(pagePath)
 	outfile := strings.TrimSuffix(path.Join(core.CacheDir, b.page.File), filepath.Ext(b.page.File)) + ".ssr.js"
 
 	return esbuild.BuildOptions{
@@ -78,13 +223,13 @@ func (b *bundler) backendOptions() esbuild.BuildOptions {
 		Stdin: &esbuild.StdinOptions{
 			ResolveDir: pageDir,
 			Loader:     esbuild.LoaderTSX,
-			Contents:   strings.ReplaceAll(serverEntry, "$page", pageName),
+			Contents:   b.entryContents(b.serverEntry()),
 		},
 		Format:   esbuild.FormatESModule,
 		Platform: esbuild.PlatformBrowser, // quickjs-go environment requires browser platform for proper tree-shaking
 		Target:   esbuild.ES2020,
 		Banner: map[string]string{
-			"js": textEncoderPolyfill + consolePolyfill,
+			"js": textEncoderPolyfill + consolePolyfill + streamPolyfill,
 		},
 		Loader:            serverLoaderMap,
 		Bundle:            true,
@@ -93,6 +238,7 @@ func (b *bundler) backendOptions() esbuild.BuildOptions {
 		MinifyIdentifiers: core.IsProd(),
 		MinifySyntax:      core.IsProd(),
 		Sourcemap:         getSourcemapMode(),
+		Plugins:           []esbuild.Plugin{runtimePlugin(), islandsPlugin()},
 	}
 }
 
@@ -108,103 +254,277 @@ func (b *bundler) buildBackend() (string, error) {
 	return string(result.OutputFiles[0].Contents), nil
 }
 
-func (b *bundler) clientOptions() esbuild.BuildOptions {
-	pagePath, _ := filepath.Abs(b.page.File)
-	pageDir := filepath.Dir(pagePath)
-	pageName := filepath.Base(pagePath)
-	outfile := strings.TrimSuffix(path.Join(core.CacheDir, b.page.File), filepath.Ext(b.page.File)) + ".js"
+func (b *bundler) watchServer() error {
+	ctx, err := esbuild.Context(b.backendOptions())
+	if err != nil {
+		return err
+	}
 
-	clientOpts := esbuild.BuildOptions{
-		Outfile: outfile,
-		Stdin: &esbuild.StdinOptions{
-			ResolveDir: pageDir,
-			Loader:     esbuild.LoaderTSX,
-			Contents:   strings.ReplaceAll(clientEntry, "$page", pageName),
-		},
-		Format:            esbuild.FormatESModule,
-		Platform:          esbuild.PlatformBrowser,
-		Target:            esbuild.ES2020,
-		Loader:            clientLoaderMap,
-		Bundle:            true,
-		Write:             true,
-		MinifyWhitespace:  core.IsProd(),
-		MinifyIdentifiers: core.IsProd(),
-		MinifySyntax:      core.IsProd(),
-		Sourcemap:         getSourcemapMode(),
-		Plugins: []esbuild.Plugin{
-			newTailwindPlugin(core.IsProd(), false), // disable caching in dev for hot reload
-		},
+	err2 := ctx.Watch(esbuild.WatchOptions{})
+	if err2 != nil {
+		return err2
 	}
 
-	return clientOpts
+	return nil
 }
 
-func (b *bundler) buildClient() (string, string, error) {
-	result := esbuild.Build(b.clientOptions())
+// serverWatchers keeps the watch contexts of the pages' server bundles, so a page whose
+// entry changed, e.g. with its layouts, is watched with the new one.
+type serverWatchers struct {
+	mu       sync.Mutex
+	contexts map[string]esbuild.BuildContext
+}
 
-	if result.Errors != nil && len(result.Errors) > 0 {
-		errorMsg := formatBuildErrors(result.Errors)
-		context := ExtractBuildErrorContext(errorMsg)
-		return "", "", fmt.Errorf("client bundle error: %s", context)
-	}
+func newServerWatchers() *serverWatchers {
+	return &serverWatchers{contexts: map[string]esbuild.BuildContext{}}
+}
 
-	jsResult := ""
-	cssResult := ""
+// watch watches the page's server bundle, replacing its previous watcher.
+func (w *serverWatchers) watch(b *bundler) error {
+	ctx, err := esbuild.Context(b.backendOptions())
+	if err != nil {
+		return err
+	}
 
-	for _, file := range result.OutputFiles {
-		if strings.HasSuffix(file.Path, ".js") {
-			jsResult = string(file.Contents)
-		}
-		if strings.HasSuffix(file.Path, ".css") {
-			cssResult = string(file.Contents)
-		}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if previous, ok := w.contexts[b.page.File]; ok {
+		previous.Dispose()
 	}
+	w.contexts[b.page.File] = ctx
+	return ctx.Watch(esbuild.WatchOptions{})
+}
 
-	if jsResult == "" {
-		return "", "", fmt.Errorf("client bundle error: no JavaScript output generated")
+// stop stops watching the server bundle of a removed page.
+func (w *serverWatchers) stop(file string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if ctx, ok := w.contexts[file]; ok {
+		ctx.Dispose()
+		delete(w.contexts, file)
 	}
+}
 
-	return jsResult, cssResult, nil
+// clientOutput returns a page's client entry path below the cache dir without
+// extension, e.g. "pages/index".
+func clientOutput(file string) string {
+	output := strings.TrimSuffix(path.Join(core.CacheDir, filepath.ToSlash(file)), filepath.Ext(file))
+	return strings.TrimPrefix(output, core.CacheDir+"/")
 }
 
-func (b *bundler) watchServer() error {
-	ctx, err := esbuild.Context(b.backendOptions())
-	if err != nil {
-		return err
+// pageEntriesPlugin loads the pages' client entries, named "alloy-page:" plus the
+// page's absolute path.
+func pageEntriesPlugin(pages map[string]*bundler) esbuild.Plugin {
+	return esbuild.Plugin{
+		Name: "alloy-page-entries",
+		Setup: func(build esbuild.PluginBuild) {
+			build.OnResolve(esbuild.OnResolveOptions{Filter: `^alloy-page:`}, func(args esbuild.OnResolveArgs) (esbuild.OnResolveResult, error) {
+				return esbuild.OnResolveResult{
+					Path:      strings.TrimPrefix(args.Path, "alloy-page:"),
+					Namespace: "alloy-page-entry",
+				}, nil
+			})
+			build.OnLoad(esbuild.OnLoadOptions{Filter: `.*`, Namespace: "alloy-page-entry"}, func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+				b, ok := pages[args.Path]
+				if !ok {
+					return esbuild.OnLoadResult{}, fmt.Errorf("unknown page %s", args.Path)
+				}
+				contents := b.entryContents(clientEntry)
+				return esbuild.OnLoadResult{
+					Contents:   &contents,
+					ResolveDir: filepath.Dir(args.Path),
+					Loader:     esbuild.LoaderTSX,
+				}, nil
+			})
+		},
 	}
+}
 
-	err2 := ctx.Watch(esbuild.WatchOptions{})
-	if err2 != nil {
-		return err2
+// chunksPlugin writes next to each page's client entry the manifest of the shared chunks
+// it imports, directly or through other chunks, e.g. pages/index.chunks.json. The
+// document preloads them along with the entry.
+func chunksPlugin() esbuild.Plugin {
+	return esbuild.Plugin{
+		Name: "alloy-chunks",
+		Setup: func(build esbuild.PluginBuild) {
+			build.OnEnd(func(result *esbuild.BuildResult) (esbuild.OnEndResult, error) {
+				if len(result.Errors) > 0 {
+					return esbuild.OnEndResult{}, nil
+				}
+				return esbuild.OnEndResult{}, writeChunkManifests(result.Metafile)
+			})
+		},
+	}
+}
+
+func writeChunkManifests(metafile string) error {
+	var meta struct {
+		Outputs map[string]struct {
+			EntryPoint string `json:"entryPoint"`
+			Imports    []struct {
+				Path string `json:"path"`
+				Kind string `json:"kind"`
+			} `json:"imports"`
+		} `json:"outputs"`
+	}
+	if err := json.Unmarshal([]byte(metafile), &meta); err != nil {
+		return fmt.Errorf("failed to read client metafile: %w", err)
 	}
 
+	for output, entry := range meta.Outputs {
+		if entry.EntryPoint == "" || !strings.HasSuffix(output, ".js") {
+			continue
+		}
+
+		// Dynamic imports load on demand, so only static ones are followed.
+		chunks := []string{}
+		seen := map[string]bool{output: true}
+		for queue := []string{output}; len(queue) > 0; queue = queue[1:] {
+			for _, imported := range meta.Outputs[queue[0]].Imports {
+				if imported.Kind != "import-statement" || seen[imported.Path] {
+					continue
+				}
+				seen[imported.Path] = true
+				chunks = append(chunks, imported.Path)
+				queue = append(queue, imported.Path)
+			}
+		}
+
+		manifest, err := json.Marshal(chunks)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(strings.TrimSuffix(output, ".js")+".chunks.json", manifest, 0644); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (b *bundler) watchClient() error {
-	ctx, err := esbuild.Context(b.clientOptions())
-	if err != nil {
-		return err
+// clientBundler builds the client entries of every page in one build, so React, the
+// runtime and modules shared between pages are split into chunks loaded once.
+type clientBundler struct {
+	pages []*bundler
+	// styles are the app's stylesheets, left out of the pages' bundles. Nil without _app.tsx.
+	styles *appStyles
+	mu     sync.Mutex
+	ctx    esbuild.BuildContext
+}
+
+func newClientBundler(pages []alloy.Page, styles *appStyles) *clientBundler {
+	b := &clientBundler{styles: styles}
+	b.setPages(pages)
+	return b
+}
+
+func (b *clientBundler) setPages(pages []alloy.Page) {
+	b.pages = make([]*bundler, len(pages))
+	for i := range pages {
+		page := pages[i]
+		b.pages[i] = &bundler{page: &page}
 	}
+}
 
-	err2 := ctx.Watch(esbuild.WatchOptions{})
-	if err2 != nil {
-		return err2
+func (b *clientBundler) options() esbuild.BuildOptions {
+	entries := make(map[string]*bundler, len(b.pages))
+	var entryPoints []esbuild.EntryPoint
+	for _, page := range b.pages {
+		absFile, _ := filepath.Abs(page.page.File)
+		entries[absFile] = page
+		entryPoints = append(entryPoints, esbuild.EntryPoint{
+			InputPath:  "alloy-page:" + absFile,
+			OutputPath: clientOutput(page.page.File),
+		})
 	}
 
+	plugins := []esbuild.Plugin{
+		runtimePlugin(),
+		pageEntriesPlugin(entries),
+		islandsPlugin(),
+		newTailwindPlugin(core.IsProd(), false), // disable caching in dev for hot reload
+		chunksPlugin(),
+	}
+	if b.styles != nil {
+		plugins = append([]esbuild.Plugin{b.styles.plugin()}, plugins...)
+	}
+
+	return esbuild.BuildOptions{
+		EntryPointsAdvanced: entryPoints,
+		Outdir:              core.CacheDir,
+		ChunkNames:          "chunks/[name]-[hash]",
+		Splitting:           true,
+		Format:              esbuild.FormatESModule,
+		Platform:            esbuild.PlatformBrowser,
+		Target:              esbuild.ES2020,
+		Loader:              clientLoaderMap,
+		Bundle:              true,
+		Write:               true,
+		Metafile:            true,
+		MinifyWhitespace:    core.IsProd(),
+		MinifyIdentifiers:   core.IsProd(),
+		MinifySyntax:        core.IsProd(),
+		Sourcemap:           getSourcemapMode(),
+		Plugins:             plugins,
+	}
+}
+
+func (b *clientBundler) build() error {
+	result := esbuild.Build(b.options())
+
+	if len(result.Errors) > 0 {
+		errorMsg := formatBuildErrors(result.Errors)
+		context := ExtractBuildErrorContext(errorMsg)
+		return fmt.Errorf("client bundle error: %s", context)
+	}
 	return nil
 }
 
-func (b *bundler) watch() error {
-	err := b.watchServer()
+func (b *clientBundler) watch() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.startWatching()
+}
+
+func (b *clientBundler) startWatching() error {
+	ctx, err := esbuild.Context(b.options())
 	if err != nil {
 		return err
 	}
+	b.ctx = ctx
+	return ctx.Watch(esbuild.WatchOptions{})
+}
 
-	err = b.watchClient()
-	if err != nil {
+// update replaces the bundler's pages, rebuilds their client entries and keeps
+// watching them.
+func (b *clientBundler) update(pages []alloy.Page) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.setPages(pages)
+	return b.restart()
+}
+
+// rebuild rebuilds the pages' client entries and keeps watching them, e.g. once the
+// app's stylesheets changed.
+func (b *clientBundler) rebuild() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.restart()
+}
+
+func (b *clientBundler) restart() error {
+	if b.ctx != nil {
+		b.ctx.Dispose()
+		b.ctx = nil
+	}
+	// Keep watching a failed build, so fixing the error rebuilds it.
+	buildErr := b.build()
+	if err := b.startWatching(); err != nil {
 		return err
 	}
-
-	return nil
+	return buildErr
 }
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bertilxi/alloy"
+	"github.com/bertilxi/alloy/core"
+)
+
+// writeReactStubs writes minimal react and react-dom packages, enough for the bundles
+// to resolve their imports.
+func writeReactStubs(t *testing.T) {
+	t.Helper()
+	writeFiles(t, map[string]string{
+		"node_modules/react/package.json":             `{"name":"react","main":"index.js"}`,
+		"node_modules/react/index.js":                 `module.exports={createContext(){return {Provider:"P"}},useContext(){},useEffect(){},useLayoutEffect(){},createElement(){},Fragment:"F",Children:{toArray(){return []}},isValidElement(){},cloneElement(){}}`,
+		"node_modules/react-dom/package.json":         `{"name":"react-dom"}`,
+		"node_modules/react-dom/client/index.js":      `module.exports={hydrateRoot(){return {unmount(){}}},createRoot(){}}`,
+		"node_modules/react-dom/server.edge/index.js": `module.exports={renderToString(){return ""},renderToStaticMarkup(){return ""},renderToReadableStream(){}}`,
+	})
+}
+
+func TestClientBundler(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeReactStubs(t)
+	writeFiles(t, map[string]string{
+		"components/Nav.tsx": `export default function Nav() { return <nav>nav</nav>; }`,
+		"pages/index.tsx":    `import Nav from "../components/Nav"; export default function Index() { return <Nav />; }`,
+		"pages/about.tsx":    `import Nav from "../components/Nav"; import "./about.css"; export default function About() { return <Nav />; }`,
+		"pages/about.css":    `p { color: red; }`,
+	})
+
+	pages, err := alloy.DiscoverPages("pages", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := newClientBundler(pages, nil).build(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every page gets its entry and stylesheet from the one build.
+	for _, file := range []string{"pages/index.js", "pages/about.js", "pages/about.css"} {
+		if _, err := os.Stat(filepath.Join(core.CacheDir, file)); err != nil {
+			t.Errorf("expected %s: %v", file, err)
+		}
+	}
+
+	// Modules shared between pages are split into chunks, listed in each entry's manifest.
+	for _, page := range []string{"pages/index.tsx", "pages/about.tsx"} {
+		manifest, err := os.ReadFile(core.PageCacheKey(page, "chunks.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var chunks []string
+		if err := json.Unmarshal(manifest, &chunks); err != nil {
+			t.Fatal(err)
+		}
+		if len(chunks) == 0 {
+			t.Fatalf("%s: expected shared chunks, got none", page)
+		}
+		for _, chunk := range chunks {
+			if !strings.HasPrefix(chunk, core.CacheDir+"/chunks/") {
+				t.Errorf("%s: expected a chunk below %s/chunks, got %q", page, core.CacheDir, chunk)
+			}
+			if _, err := os.Stat(chunk); err != nil {
+				t.Errorf("%s: expected chunk %s: %v", page, chunk, err)
+			}
+		}
+	}
+}
+
+func TestClientOutput(t *testing.T) {
+	for file, want := range map[string]string{
+		"pages/index.tsx":       "pages/index",
+		"pages/blog/[slug].tsx": "pages/blog/[slug]",
+		"pages/404.tsx":         "pages/404",
+	} {
+		if got := clientOutput(filepath.FromSlash(file)); got != want {
+			t.Errorf("clientOutput(%q) = %q, want %q", file, got, want)
+		}
+	}
+}
@@ -46,7 +46,9 @@ func Dev(engine *alloy.Engine) error {
 	}
 
 	// Create cache directories and do initial builds for all pages
-	for _, page := range engine.Pages {
+	pages = bundledPages(engine)
+	servers := newServerWatchers()
+	for _, page := range pages {
 		err := mkdirCache(page.File)
 		if err != nil {
 			return err
@@ -60,14 +62,60 @@ func Dev(engine *alloy.Engine) error {
 		if err != nil {
 			return err
 		}
+		fmt.Printf("✓ Built server bundle for %s\n", page.File)
 
-		_, _, err = b.buildClient()
-		if err != nil {
+		go servers.watch(&b)
+	}
+
+	// The app is built first, so the pages' build knows which stylesheets it ships.
+	app := newAppBundler(engine.Pages)
+	var styles *appStyles
+	if app != nil {
+		fmt.Printf("📦 Building %s...\n", app.file)
+		if err := app.build(); err != nil {
 			return err
 		}
-		fmt.Printf("✓ Built bundles for %s\n", page.File)
+		styles = app.styles
+	}
 
-		go b.watch()
+	clients := newClientBundler(pages, styles)
+	fmt.Printf("📦 Building client bundles...\n")
+	if err := clients.build(); err != nil {
+		return err
+	}
+	go clients.watch()
+
+	if app != nil {
+		// Stylesheets the app starts or stops importing move between the bundles.
+		app.styles.onChange = func() {
+			if err := clients.rebuild(); err != nil {
+				fmt.Printf("❌ Client build failed: %v\n", err)
+			}
+		}
+		go app.watch()
+	}
+
+	if doc := documentBundler(engine.Options.PagesDir); doc != nil {
+		if err := mkdirCache(doc.page.File); err != nil {
+			return err
+		}
+		fmt.Printf("📦 Building %s...\n", doc.page.File)
+		if _, err := doc.buildBackend(); err != nil {
+			return err
+		}
+		go doc.watchServer()
+	}
+
+	islands, err := newIslandsBundler(engine.Options.PagesDir)
+	if err != nil {
+		return err
+	}
+	if islands != nil {
+		fmt.Printf("📦 Building islands...\n")
+		if err := islands.build(); err != nil {
+			return err
+		}
+		go islands.watch()
 	}
 
 	hr := newHotReload()
@@ -75,7 +123,7 @@ func Dev(engine *alloy.Engine) error {
 	go hr.watch()
 
 	// Watch pages directory for new/renamed/deleted files
-	pw := newPagesWatcher(engine, hr)
+	pw := newPagesWatcher(engine, hr, servers, clients)
 	go pw.watch()
 
 	// Setup signal handling for graceful shutdown
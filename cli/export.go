@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bertilxi/alloy"
+	"github.com/bertilxi/alloy/core"
+)
+
+// Export builds every page and writes the site as static files to outDir: one
+// index.html and one data endpoint payload per document, plus the client bundles under .alloy. Dynamic routes are
+// expanded with their paths function; those without one are skipped with a warning.
+func Export(engine *alloy.Engine, outDir string) error {
+	if err := Build(engine); err != nil {
+		return err
+	}
+
+	// Render from the bundles just built rather than an embedded copy that may predate them.
+	engine.EmbedFS = nil
+
+	fmt.Printf("📤 Exporting static site to %s...\n", outDir)
+	return exportSite(engine, outDir)
+}
+
+// exportSite writes the documents, data payloads and client assets of the built pages to outDir.
+func exportSite(engine *alloy.Engine, outDir string) error {
+	documents := 0
+	var warnings []string
+	for i := range engine.Pages {
+		page := &engine.Pages[i]
+		page.AssignOptions(engine.Options)
+
+		paramSets, err := page.StaticParams()
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("⚠️  Skipping %s: %v", page.Route, err))
+			continue
+		}
+
+		for _, params := range paramSets {
+			urlPath, html, err := page.RenderStatic(params)
+			if err != nil {
+				return fmt.Errorf("export %s: %w", page.Route, err)
+			}
+
+			file := filepath.Join(outDir, filepath.FromSlash(urlPath), "index.html")
+			if err := writeExportFile(file, html); err != nil {
+				return err
+			}
+			fmt.Printf("✓ %s → %s\n", urlPath, file)
+			documents++
+
+			dataPath, data, err := page.RenderStaticData(params)
+			if err != nil {
+				return fmt.Errorf("export %s: %w", page.Route, err)
+			}
+			if err := writeExportFile(filepath.Join(outDir, filepath.FromSlash(dataPath)), data); err != nil {
+				return err
+			}
+		}
+	}
+
+	// pages/404.tsx is no route; static hosts serve it as 404.html for unknown paths.
+	if notFoundPage := alloy.DiscoverNotFoundPage(engine.PagesDir, engine.Loaders); notFoundPage != nil {
+		notFoundPage.AssignOptions(engine.Options)
+		html, err := notFoundPage.RenderStaticNotFound()
+		if err != nil {
+			return fmt.Errorf("export %s: %w", notFoundPage.File, err)
+		}
+		file := filepath.Join(outDir, "404.html")
+		if err := writeExportFile(file, html); err != nil {
+			return err
+		}
+		fmt.Printf("✓ %s → %s\n", notFoundPage.File, file)
+		documents++
+	}
+
+	if err := copyClientAssets(filepath.Join(outDir, core.CacheDir)); err != nil {
+		return fmt.Errorf("copy client assets: %w", err)
+	}
+
+	for _, warning := range warnings {
+		fmt.Println(warning)
+	}
+	fmt.Printf("✓ Exported %d documents to %s\n", documents, outDir)
+	return nil
+}
+
+// copyClientAssets copies the build output to outDir, leaving out server bundles,
+// prerendered documents and chunk manifests.
+func copyClientAssets(outDir string) error {
+	return filepath.WalkDir(core.CacheDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		name := d.Name()
+		if name == "keep" || strings.HasSuffix(name, ".ssr.js") || strings.HasSuffix(name, ".ssr.js.map") || strings.HasSuffix(name, ".html") || strings.HasSuffix(name, ".chunks.json") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(core.CacheDir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return writeExportFile(filepath.Join(outDir, rel), data)
+	})
+}
+
+func writeExportFile(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(file), err)
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bertilxi/alloy"
+	"github.com/bertilxi/alloy/core"
+	"github.com/gin-gonic/gin"
+)
+
+// writeFiles writes files, relative to the working directory, creating their directories.
+func writeFiles(t *testing.T, files map[string]string) {
+	t.Helper()
+	for file, content := range files {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExportSite(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Chdir(t.TempDir())
+	t.Cleanup(alloy.ClearBundleCache)
+
+	files := map[string]string{
+		"pages/index.tsx": "",
+		"pages/about.tsx": "",
+		"pages/404.tsx":   "",
+	}
+	for page, html := range map[string]string{
+		"pages/index.tsx": "<h1>home</h1>",
+		"pages/about.tsx": "<h1>about</h1>",
+		"pages/404.tsx":   "<h1>not found</h1>",
+	} {
+		files[core.PageCacheKey(page, "ssr.js")] = `globalThis.renderPage = function (props) { return "` + html + `"; }`
+		files[core.PageCacheKey(page, "js")] = ""
+		files[core.PageCacheKey(page, "css")] = ""
+	}
+	files[filepath.Join(core.CacheDir, "chunks", "chunk-react.js")] = "export {}"
+	files[core.PageCacheKey("pages/index.tsx", "chunks.json")] = `[".alloy/chunks/chunk-react.js"]`
+	writeFiles(t, files)
+
+	engine := alloy.New(alloy.Options{
+		Router:   gin.New(),
+		PagesDir: "pages",
+		Loaders: map[string]alloy.PageLoader{
+			"/about": func(c *gin.Context) (any, error) { return map[string]any{"team": "alloy"}, nil },
+		},
+	})
+	pages, err := alloy.DiscoverPages("pages", engine.Loaders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.Pages = pages
+
+	if err := exportSite(engine, "dist"); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, want := range map[string]string{
+		"dist/index.html":                   "<h1>home</h1>",
+		"dist/about/index.html":             "<h1>about</h1>",
+		"dist/404.html":                     "<h1>not found</h1>",
+		"dist/_alloy/data/index.json":       `"module":"/.alloy/pages/index.js"`,
+		"dist/_alloy/data/about.json":       `"team":"alloy"`,
+		"dist/.alloy/pages/index.js":        "",
+		"dist/.alloy/chunks/chunk-react.js": "export {}",
+	} {
+		content, err := os.ReadFile(filepath.FromSlash(file))
+		if err != nil {
+			t.Errorf("expected %s: %v", file, err)
+			continue
+		}
+		if !strings.Contains(string(content), want) {
+			t.Errorf("%s: expected %q in %q", file, want, content)
+		}
+	}
+
+	// pages/404.tsx is exported as 404.html only, and server bundles and manifests stay private.
+	for _, file := range []string{"dist/404/index.html", "dist/.alloy/pages/index.ssr.js", "dist/.alloy/pages/index.chunks.json"} {
+		if _, err := os.Stat(filepath.FromSlash(file)); err == nil {
+			t.Errorf("expected no %s", file)
+		}
+	}
+}
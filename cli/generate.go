@@ -158,7 +158,7 @@ var LoaderRegistry = map[string]alloy.PageLoader{
 
 	// Add each page loader (not API handlers)
 	for _, loader := range loaders {
-		if !loader.IsAPI {
+		if !loader.IsAPI && !loader.IsLayout && loader.FunctionName != "" {
 			sb.WriteString(fmt.Sprintf(`	"%s": %s,
 `, loader.Route, loader.FunctionName))
 		}
@@ -184,6 +184,48 @@ var HandlerRegistry = map[string]gin.HandlerFunc{
 		}
 	}
 
+	sb.WriteString(`}
+
+// LayoutLoaderRegistry maps layout directory routes to the loaders of their _layout.tsx files.
+var LayoutLoaderRegistry = map[string]alloy.PageLoader{
+`)
+
+	// Add each layout loader
+	for _, loader := range loaders {
+		if loader.IsLayout && loader.FunctionName != "" {
+			sb.WriteString(fmt.Sprintf(`	"%s": %s,
+`, loader.Route, loader.FunctionName))
+		}
+	}
+
+	sb.WriteString(`}
+
+// ActionRegistry maps page routes to the actions handling form POSTs to them.
+var ActionRegistry = map[string]alloy.PageAction{
+`)
+
+	// Add each page action
+	for _, loader := range loaders {
+		if loader.ActionFunction != "" {
+			sb.WriteString(fmt.Sprintf(`	"%s": %s,
+`, loader.Route, loader.ActionFunction))
+		}
+	}
+
+	sb.WriteString(`}
+
+// PathsRegistry maps dynamic page routes to the functions listing their params for static export.
+var PathsRegistry = map[string]alloy.PathsFunc{
+`)
+
+	// Add each paths function
+	for _, loader := range loaders {
+		if loader.PathsFunction != "" {
+			sb.WriteString(fmt.Sprintf(`	"%s": %s,
+`, loader.Route, loader.PathsFunction))
+		}
+	}
+
 	sb.WriteString(`}
 `)
 
@@ -33,6 +33,9 @@ func newHotReload() *hotReload {
 }
 
 func (hr *hotReload) reload() {
+	// Renders pick up the new bundles whether or not a browser is connected.
+	alloy.ClearBundleCache()
+
 	hr.mutex.RLock()
 	defer hr.mutex.RUnlock()
 
@@ -40,8 +43,6 @@ func (hr *hotReload) reload() {
 		return
 	}
 
-	alloy.ClearBundleCache()
-
 	for conn, writeMutex := range hr.connections {
 		go func(c *websocket.Conn, m *sync.Mutex) {
 			m.Lock()
@@ -0,0 +1,190 @@
+package cli
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bertilxi/alloy/core"
+	esbuild "github.com/evanw/esbuild/pkg/api"
+)
+
+// islandsDir is where the islands' client entries and their shared chunks are written.
+var islandsDir = path.Join(core.CacheDir, "islands")
+
+// islandWrapper replaces an island's default export in page bundles with a component
+// rendering it inside an <alloy-island> marker, which records the island's entry and
+// props for the browser to hydrate it from.
+const islandWrapper = `import React from "react";
+import { Island } from "alloy";
+import Component from $file;
+
+export default function AlloyIsland(props) {
+  return <Island src=$src component={Component} props={props} />;
+}`
+
+// islandEntry is an island's client entry. It hydrates every marker of the island
+// that is not already part of an enclosing island.
+const islandEntry = `import ReactDOM from "react-dom/client";
+import { hydrateIslands } from "alloy/islands";
+import Component from $file;
+
+hydrateIslands(ReactDOM, $src, Component);`
+
+// islandOutput returns an island's output path below islandsDir without extension,
+// e.g. "components/Counter.island", and reports false when it lies outside the project.
+func islandOutput(file string) (string, bool) {
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return "", false
+	}
+	absRoot, err := filepath.Abs(".")
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(absRoot, absFile)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return strings.TrimSuffix(filepath.ToSlash(rel), ".tsx"), true
+}
+
+// islandURL returns the URL of an island's client entry.
+func islandURL(output string) string {
+	return "/" + path.Join(islandsDir, output) + ".js"
+}
+
+func fillIsland(template, file, output string) string {
+	return strings.NewReplacer(
+		"$file", fmt.Sprintf("%q", filepath.ToSlash(file)),
+		"$src", fmt.Sprintf("%q", islandURL(output)),
+	).Replace(template)
+}
+
+// islandsPlugin wraps the islands that modules import by relative path, e.g.
+// "./Counter.island", so they render inside their markers. The wrappers and the
+// islands' entries import the islands themselves unwrapped.
+func islandsPlugin() esbuild.Plugin {
+	return esbuild.Plugin{
+		Name: "alloy-islands",
+		Setup: func(build esbuild.PluginBuild) {
+			build.OnResolve(esbuild.OnResolveOptions{Filter: `\.island(\.tsx)?$`}, func(args esbuild.OnResolveArgs) (esbuild.OnResolveResult, error) {
+				if args.Namespace != "file" || !strings.HasPrefix(args.Path, ".") {
+					return esbuild.OnResolveResult{}, nil
+				}
+				file := filepath.Join(args.ResolveDir, args.Path)
+				if !strings.HasSuffix(file, ".tsx") {
+					file += ".tsx"
+				}
+				if _, ok := islandOutput(file); !ok {
+					return esbuild.OnResolveResult{}, nil
+				}
+				return esbuild.OnResolveResult{Path: file, Namespace: "alloy-island"}, nil
+			})
+			build.OnLoad(esbuild.OnLoadOptions{Filter: `.*`, Namespace: "alloy-island"}, func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+				output, _ := islandOutput(args.Path)
+				contents := fillIsland(islandWrapper, args.Path, output)
+				return esbuild.OnLoadResult{
+					Contents:   &contents,
+					ResolveDir: filepath.Dir(args.Path),
+					Loader:     esbuild.LoaderTSX,
+				}, nil
+			})
+		},
+	}
+}
+
+// islandEntriesPlugin loads the islands' client entries, named "alloy-island:" plus
+// the island's path.
+func islandEntriesPlugin() esbuild.Plugin {
+	return esbuild.Plugin{
+		Name: "alloy-island-entries",
+		Setup: func(build esbuild.PluginBuild) {
+			build.OnResolve(esbuild.OnResolveOptions{Filter: `^alloy-island:`}, func(args esbuild.OnResolveArgs) (esbuild.OnResolveResult, error) {
+				return esbuild.OnResolveResult{
+					Path:      strings.TrimPrefix(args.Path, "alloy-island:"),
+					Namespace: "alloy-island-entry",
+				}, nil
+			})
+			build.OnLoad(esbuild.OnLoadOptions{Filter: `.*`, Namespace: "alloy-island-entry"}, func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+				output, _ := islandOutput(args.Path)
+				contents := fillIsland(islandEntry, args.Path, output)
+				return esbuild.OnLoadResult{
+					Contents:   &contents,
+					ResolveDir: filepath.Dir(args.Path),
+					Loader:     esbuild.LoaderTSX,
+				}, nil
+			})
+		},
+	}
+}
+
+// islandsBundler builds the client entries of the project's islands in one build, so
+// React and shared modules are split into chunks loaded once per page.
+type islandsBundler struct {
+	files []string
+}
+
+// newIslandsBundler returns a bundler for the islands in the pages directory and the
+// project's source directories, or nil if it has none.
+func newIslandsBundler(pagesDir string) (*islandsBundler, error) {
+	files, err := core.DiscoverIslandFiles(pagesDir)
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+	return &islandsBundler{files: files}, nil
+}
+
+func (b *islandsBundler) options() esbuild.BuildOptions {
+	var entryPoints []esbuild.EntryPoint
+	for _, file := range b.files {
+		output, ok := islandOutput(file)
+		if !ok {
+			continue
+		}
+		absFile, _ := filepath.Abs(file)
+		entryPoints = append(entryPoints, esbuild.EntryPoint{
+			InputPath:  "alloy-island:" + absFile,
+			OutputPath: output,
+		})
+	}
+
+	return esbuild.BuildOptions{
+		EntryPointsAdvanced: entryPoints,
+		Outdir:              islandsDir,
+		ChunkNames:          "chunks/[name]-[hash]",
+		Splitting:           true,
+		Format:              esbuild.FormatESModule,
+		Platform:            esbuild.PlatformBrowser,
+		Target:              esbuild.ES2020,
+		// Island styles ship in the bundles of the pages that render them.
+		Loader:            serverLoaderMap,
+		Bundle:            true,
+		Write:             true,
+		MinifyWhitespace:  core.IsProd(),
+		MinifyIdentifiers: core.IsProd(),
+		MinifySyntax:      core.IsProd(),
+		Sourcemap:         getSourcemapMode(),
+		Plugins:           []esbuild.Plugin{runtimePlugin(), islandEntriesPlugin(), islandsPlugin()},
+	}
+}
+
+func (b *islandsBundler) build() error {
+	result := esbuild.Build(b.options())
+
+	if len(result.Errors) > 0 {
+		errorMsg := formatBuildErrors(result.Errors)
+		context := ExtractBuildErrorContext(errorMsg)
+		return fmt.Errorf("islands bundle error: %s", context)
+	}
+	return nil
+}
+
+func (b *islandsBundler) watch() error {
+	ctx, err := esbuild.Context(b.options())
+	if err != nil {
+		return err
+	}
+	return ctx.Watch(esbuild.WatchOptions{})
+}
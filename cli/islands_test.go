@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/bertilxi/alloy/core"
+)
+
+func TestNewIslandsBundler(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	if islands, err := newIslandsBundler("pages"); err != nil || islands != nil {
+		t.Fatalf("expected no bundler without islands, got %+v, %v", islands, err)
+	}
+
+	writeFiles(t, map[string]string{
+		"pages/index.tsx":                        "",
+		"pages/blog/Like.island.tsx":             "",
+		"components/Counter.island.tsx":          "",
+		"src/widgets/Chart.island.tsx":           "",
+		"lib/Menu.island.tsx":                    "",
+		"components/node_modules/x/X.island.tsx": "",
+		"components/.cache/Y.island.tsx":         "",
+		"scripts/Stray.island.tsx":               "",
+		"node_modules/pkg/Dep.island.tsx":        "",
+	})
+
+	islands, err := newIslandsBundler("pages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join("components", "Counter.island.tsx"),
+		filepath.Join("lib", "Menu.island.tsx"),
+		filepath.Join("pages", "blog", "Like.island.tsx"),
+		filepath.Join("src", "widgets", "Chart.island.tsx"),
+	}
+	got := slices.Sorted(slices.Values(islands.files))
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got islands %v, want %v", got, want)
+	}
+
+	// Each island gets its own entry below the islands directory.
+	var outputs []string
+	for _, entry := range islands.options().EntryPointsAdvanced {
+		outputs = append(outputs, entry.OutputPath)
+	}
+	slices.Sort(outputs)
+	wantOutputs := []string{"components/Counter.island", "lib/Menu.island", "pages/blog/Like.island", "src/widgets/Chart.island"}
+	if !reflect.DeepEqual(outputs, wantOutputs) {
+		t.Fatalf("got outputs %v, want %v", outputs, wantOutputs)
+	}
+	if url := islandURL("components/Counter.island"); url != "/"+core.CacheDir+"/islands/components/Counter.island.js" {
+		t.Fatalf("got island URL %q", url)
+	}
+}
+
+func TestIslandOutput(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	if output, ok := islandOutput(filepath.Join("components", "Counter.island.tsx")); !ok || output != "components/Counter.island" {
+		t.Fatalf("got %q, %v", output, ok)
+	}
+	// Islands outside the project have no entry.
+	if output, ok := islandOutput(filepath.Join("..", "elsewhere", "Counter.island.tsx")); ok {
+		t.Fatalf("expected no output outside the project, got %q", output)
+	}
+}
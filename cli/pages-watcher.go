@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -19,16 +20,20 @@ type pagesWatcher struct {
 	debounce  time.Duration
 	lastEvent time.Time
 	hotReload *hotReload
+	servers   *serverWatchers
+	clients   *clientBundler
 	mu        sync.Mutex
 }
 
-func newPagesWatcher(engine *alloy.Engine, hotReload *hotReload) *pagesWatcher {
+func newPagesWatcher(engine *alloy.Engine, hotReload *hotReload, servers *serverWatchers, clients *clientBundler) *pagesWatcher {
 	return &pagesWatcher{
 		engine:    engine,
 		pagesDir:  engine.PagesDir,
 		debounce:  200 * time.Millisecond,
 		lastEvent: time.Now(),
 		hotReload: hotReload,
+		servers:   servers,
+		clients:   clients,
 		mu:        sync.Mutex{},
 	}
 }
@@ -81,11 +86,13 @@ func (pw *pagesWatcher) processPageChanges() error {
 	}
 
 	// Check for new or modified pages
+	entriesChanged := false
 	for route, newPage := range newPageMap {
 		if oldPage, exists := oldPageMap[route]; !exists {
 			// New page
 			fmt.Printf("📄 New page detected: %s (%s)\n", route, newPage.File)
 			pw.registerNewPage(newPage)
+			entriesChanged = true
 		} else if oldPage.File != newPage.File {
 			// Page file changed
 			fmt.Printf("✏️  Page modified: %s\n", route)
@@ -93,21 +100,63 @@ func (pw *pagesWatcher) processPageChanges() error {
 	}
 
 	// Check for deleted pages
-	for route := range oldPageMap {
+	for route, oldPage := range oldPageMap {
 		if _, exists := newPageMap[route]; !exists {
 			fmt.Printf("🗑️  Page removed: %s\n", route)
+			pw.servers.stop(oldPage.File)
+			entriesChanged = true
 		}
 	}
 
 	// Update engine pages
+	oldBundled := bundledPages(pw.engine)
 	pw.engine.Pages = newPages
 
+	// Entries are generated with the layouts and _app.tsx they import, so pages whose
+	// layouts changed are rebuilt with the new ones
+	for _, page := range bundledPages(pw.engine) {
+		i := slices.IndexFunc(oldBundled, func(old alloy.Page) bool { return old.File == page.File })
+		if i < 0 || !layoutsChanged(oldBundled[i], page) {
+			continue
+		}
+		fmt.Printf("🧩 Layouts of %s changed, rebuilding...\n", page.File)
+		pw.rebuildPage(&page)
+		entriesChanged = true
+	}
+
+	// Every page's client entry is part of one build, so it restarts with the new set
+	if entriesChanged {
+		if err := pw.clients.update(bundledPages(pw.engine)); err != nil {
+			fmt.Printf("❌ Client build failed: %v\n", err)
+		}
+	}
+
 	// Trigger hot reload
 	pw.hotReload.reload()
 
 	return nil
 }
 
+// layoutsChanged reports whether a page is composed with other layouts or _app.tsx.
+func layoutsChanged(old, page alloy.Page) bool {
+	return old.App != page.App || !slices.EqualFunc(old.Layouts, page.Layouts, func(a, b alloy.Layout) bool { return a.File == b.File })
+}
+
+// rebuildPage rebuilds a page's server bundle and watches it with its new entry.
+func (pw *pagesWatcher) rebuildPage(page *alloy.Page) {
+	b := bundler{page: page}
+	_, buildErr := b.buildBackend()
+	// Keep watching a failed build, so fixing the error rebuilds it
+	if err := pw.servers.watch(&b); err != nil {
+		fmt.Printf("❌ Failed to watch %s: %v\n", page.File, err)
+	}
+	if buildErr != nil {
+		fmt.Printf("❌ Backend build failed: %v\n", buildErr)
+		return
+	}
+	fmt.Printf("✓ Built server bundle for %s\n", page.File)
+}
+
 func (pw *pagesWatcher) registerNewPage(page *alloy.Page) error {
 	// Assign engine options to the page
 	page.AssignOptions(pw.engine.Options)
@@ -133,15 +182,10 @@ func (pw *pagesWatcher) registerNewPage(page *alloy.Page) error {
 		return err
 	}
 
-	_, _, err = b.buildClient()
-	if err != nil {
-		fmt.Printf("❌ Client build failed: %v\n", err)
-		return err
-	}
-	fmt.Printf("✓ Built bundles for %s\n", page.File)
+	fmt.Printf("✓ Built server bundle for %s\n", page.File)
 
-	// Start watching the new page
-	go b.watch()
+	// Start watching the new page; its client entry joins the pages' client build
+	go pw.servers.watch(&b)
 
 	return nil
 }
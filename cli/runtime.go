@@ -0,0 +1,51 @@
+package cli
+
+import (
+	_ "embed"
+
+	esbuild "github.com/evanw/esbuild/pkg/api"
+)
+
+var (
+	//go:embed runtime/alloy.tsx
+	runtimeSource string
+	//go:embed runtime/client.tsx
+	clientRuntimeSource string
+	//go:embed runtime/islands.tsx
+	islandsRuntimeSource string
+)
+
+// runtimeModules are the embedded Alloy client runtime modules by import path: "alloy"
+// for pages, "alloy/client" for the generated client entries and "alloy/islands" for
+// the generated island entries.
+var runtimeModules = map[string]*string{
+	"alloy":         &runtimeSource,
+	"alloy/client":  &clientRuntimeSource,
+	"alloy/islands": &islandsRuntimeSource,
+}
+
+// runtimePlugin resolves imports of the runtime modules to their embedded sources. Their
+// own imports, such as react, resolve from the importing file's directory, so the
+// runtime shares the project's React.
+func runtimePlugin() esbuild.Plugin {
+	return esbuild.Plugin{
+		Name: "alloy-runtime",
+		Setup: func(build esbuild.PluginBuild) {
+			build.OnResolve(esbuild.OnResolveOptions{Filter: `^alloy(/client|/islands)?$`}, func(args esbuild.OnResolveArgs) (esbuild.OnResolveResult, error) {
+				return esbuild.OnResolveResult{
+					Path:       args.Path,
+					Namespace:  "alloy-runtime",
+					PluginData: args.ResolveDir,
+				}, nil
+			})
+			build.OnLoad(esbuild.OnLoadOptions{Filter: `.*`, Namespace: "alloy-runtime"}, func(args esbuild.OnLoadArgs) (esbuild.OnLoadResult, error) {
+				resolveDir, _ := args.PluginData.(string)
+				return esbuild.OnLoadResult{
+					Contents:   runtimeModules[args.Path],
+					ResolveDir: resolveDir,
+					Loader:     esbuild.LoaderTSX,
+				}, nil
+			})
+		},
+	}
+}
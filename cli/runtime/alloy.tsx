@@ -0,0 +1,189 @@
+// The Alloy client runtime, imported by pages as "alloy" and bundled from the
+// copy embedded in the alloy binary.
+import React, { createContext, useContext, useEffect } from "react";
+
+type HeadElement = React.ReactElement<Record<string, any>, string>;
+
+type RequestContext = { csrf?: { token: string; field: string } } | null;
+type CSRFConfig = { cookie: string; header: string; field: string };
+
+const HeadContext = createContext<React.ReactNode[] | null>(null);
+const RequestContext = createContext<RequestContext>(null);
+
+// RequestProvider passes the server's request context, such as the CSRF token, to the
+// page during server renders. It is absent in the browser.
+export function RequestProvider(props: { value: RequestContext; children?: React.ReactNode }) {
+  return <RequestContext.Provider value={props.value}>{props.children}</RequestContext.Provider>;
+}
+
+// HeadProvider collects the children of every Head rendered below it. The server
+// entries wrap the page in it and render the collected elements into the document head.
+export function HeadProvider(props: { collector: React.ReactNode[]; children?: React.ReactNode }) {
+  return <HeadContext.Provider value={props.collector}>{props.children}</HeadContext.Provider>;
+}
+
+// Head declares <title>, <meta> and <link> elements for the document head. When several
+// Heads declare the same element, e.g. a layout's and a page's <title>, the last wins.
+export function Head(props: { children?: React.ReactNode }) {
+  const collector = useContext(HeadContext);
+  if (collector) {
+    collector.push(props.children);
+  }
+
+  useEffect(() => applyHead(props.children), [props.children]);
+  return null;
+}
+
+// headElements flattens collected Head children into elements keyed by what they
+// declare, keeping the last of each, and marks them so the client can replace them.
+export function headElements(collected: React.ReactNode[]): HeadElement[] {
+  const elements = new Map<string, HeadElement>();
+  React.Children.toArray(collected).forEach((child, index) => {
+    if (!React.isValidElement(child) || typeof child.type !== "string") {
+      return;
+    }
+    const element = child as HeadElement;
+    const key = headKey(element, index);
+    elements.delete(key);
+    elements.set(key, React.cloneElement(element, { key, "data-alloy-head": key }));
+  });
+  return [...elements.values()];
+}
+
+function headKey(element: HeadElement, index: number): string {
+  const props = element.props;
+  switch (element.type) {
+    case "title":
+      return "title";
+    case "meta": {
+      if (props.charSet) {
+        return "meta:charset";
+      }
+      const name = props.name ?? props.property ?? props.httpEquiv ?? props.itemProp;
+      return name ? "meta:" + name : "meta:" + index;
+    }
+    case "link":
+      return "link:" + props.rel + ":" + (props.href ?? "") + ":" + (props.hrefLang ?? "");
+    default:
+      return element.type + ":" + index;
+  }
+}
+
+const attributeNames: Record<string, string> = {
+  className: "class",
+  htmlFor: "for",
+  charSet: "charset",
+  httpEquiv: "http-equiv",
+  hrefLang: "hreflang",
+  crossOrigin: "crossorigin",
+  itemProp: "itemprop",
+  referrerPolicy: "referrerpolicy",
+};
+
+// applyHead replaces the head elements with the same keys as children, and returns a
+// cleanup that removes the ones it added when the Head unmounts or changes.
+function applyHead(children: React.ReactNode) {
+  const previousTitle = document.title;
+  const added: Element[] = [];
+
+  for (const element of headElements([children])) {
+    const key = element.props["data-alloy-head"];
+    if (element.type === "title") {
+      document.title = textContent(element.props.children);
+      continue;
+    }
+
+    document.head.querySelectorAll(`[data-alloy-head="${CSS.escape(key)}"]`).forEach((node) => node.remove());
+    const node = document.createElement(element.type);
+    for (const [name, value] of Object.entries(element.props)) {
+      if (name === "children" || value === null || value === undefined || value === false) {
+        continue;
+      }
+      node.setAttribute(attributeNames[name] ?? name, value === true ? "" : String(value));
+    }
+    document.head.appendChild(node);
+    added.push(node);
+  }
+
+  return () => {
+    added.forEach((node) => node.remove());
+    document.title = previousTitle;
+  };
+}
+
+function textContent(children: React.ReactNode): string {
+  return React.Children.toArray(children).join("");
+}
+
+// Link is an anchor whose prefetch prop overrides the engine's Prefetch option: "hover",
+// "viewport", "eager" or "none". Plain anchors can set data-alloy-prefetch instead.
+export function Link(props: React.AnchorHTMLAttributes<HTMLAnchorElement> & { prefetch?: "hover" | "viewport" | "eager" | "none" }) {
+  const { prefetch, ...anchor } = props;
+  return <a {...anchor} data-alloy-prefetch={prefetch} />;
+}
+
+// CSRFInput renders the hidden input carrying the CSRF token, so forms posted without
+// JavaScript pass the engine's CSRF check. It renders nothing when protection is off.
+// Shared documents, e.g. cached ones, are rendered without a token; the client router
+// fills it in when the form is submitted.
+export function CSRFInput() {
+  const csrf = useContext(RequestContext)?.csrf;
+  const field = csrf?.field ?? csrfConfig()?.field;
+  if (!field) {
+    return null;
+  }
+  return <input type="hidden" name={field} value={csrf ? csrf.token : csrfToken()} suppressHydrationWarning readOnly />;
+}
+
+// csrfToken returns the visitor's CSRF token in the browser, empty when protection is
+// off or during server renders.
+export function csrfToken(): string {
+  const config = csrfConfig();
+  if (!config) {
+    return "";
+  }
+  const prefix = config.cookie + "=";
+  const cookie = document.cookie.split("; ").find((entry) => entry.startsWith(prefix));
+  if (cookie) {
+    return decodeURIComponent(cookie.slice(prefix.length));
+  }
+  return document.querySelector('meta[name="csrf-token"]')?.getAttribute("content") ?? "";
+}
+
+// csrfHeaders returns the header carrying the CSRF token, for fetch requests with
+// unsafe methods to actions and API handlers.
+export function csrfHeaders(): Record<string, string> {
+  const config = csrfConfig();
+  return config ? { [config.header]: csrfToken() } : {};
+}
+
+function csrfConfig(): CSRFConfig | undefined {
+  return typeof window === "undefined" ? undefined : (window as any).ALLOY_CSRF;
+}
+
+// Island renders a client island inside the marker its entry hydrates, with the props
+// to hydrate it with. The bundler wraps every .island.tsx component in it; islands only
+// receive JSON-serializable props, so they take no children.
+export function Island(props: { src: string; component: React.ComponentType<any>; props: Record<string, any> }) {
+  const { children, ...islandProps } = props.props;
+  return React.createElement(
+    "alloy-island",
+    { "data-src": props.src, "data-props": JSON.stringify(islandProps), style: { display: "contents" } },
+    <props.component {...islandProps} />,
+  );
+}
+
+// navigate goes to href with the client router, or with a full page load on pages
+// that do not hydrate.
+export function navigate(href: string, options?: { replace?: boolean }): Promise<void> {
+  const router = (window as any).__alloy;
+  if (router) {
+    return router.navigate(href, options);
+  }
+  if (options?.replace) {
+    location.replace(href);
+  } else {
+    location.assign(href);
+  }
+  return Promise.resolve();
+}
@@ -0,0 +1,365 @@
+// The Alloy client router, imported by the generated client entries as "alloy/client".
+//
+// Pages' client bundles share React and this module through common chunks. The router's
+// state lives on window.__alloy and each navigation renders the next page into a fresh
+// root through its bundle's render export.
+import React, { useLayoutEffect } from "react";
+import { csrfToken } from "alloy";
+
+type PageData = { props: any; module: string; css: string; title?: string };
+type PageModule = { render: (props: any) => Promise<void> };
+type Scroll = [number, number];
+type PrefetchStrategy = "hover" | "viewport" | "eager" | "none";
+type PrefetchConfig = { strategy: PrefetchStrategy; data: boolean };
+
+interface Router {
+  navigate(href: string, options?: { replace?: boolean }): Promise<void>;
+  unmount?: () => void;
+  navigation: number;
+  location: URL;
+}
+
+declare global {
+  interface Window {
+    __alloy?: Router;
+    PAGE_PROPS?: any;
+    ALLOY_PREFETCH?: PrefetchConfig;
+    ALLOY_ROUTES?: string[];
+    ALLOY_CSRF?: { cookie: string; header: string; field: string };
+  }
+}
+
+const dataPrefix = "/_alloy/data";
+
+// Prefetched loader data is used by a navigation for this long.
+const prefetchedDataTTL = 30_000;
+
+// The router only runs once per document, so its state can live here.
+const prefetched = new Map<string, { data: Promise<PageData>; at: number }>();
+const prefetchedAssets = new Set<string>();
+let prefetchConfig: PrefetchConfig = { strategy: "hover", data: false };
+
+// mount hydrates the server-rendered page when its bundle is the first to load, and
+// returns the function that renders it after a client-side navigation.
+export function mount(
+  ReactDOM: typeof import("react-dom/client"),
+  Root: React.ComponentType<any>,
+): (props: any) => Promise<void> {
+  const container = document.getElementById("page")!;
+
+  if (!window.__alloy) {
+    const root = ReactDOM.hydrateRoot(container, <Root {...(window.PAGE_PROPS || {})} />);
+    startRouter(() => root.unmount());
+  }
+
+  return (props) =>
+    new Promise((resolve) => {
+      const router = window.__alloy!;
+      router.unmount?.();
+      const root = ReactDOM.createRoot(container);
+      root.render(
+        <Committed onCommit={resolve}>
+          <Root {...props} />
+        </Committed>,
+      );
+      router.unmount = () => root.unmount();
+    });
+}
+
+function Committed(props: { onCommit: () => void; children: React.ReactNode }) {
+  useLayoutEffect(props.onCommit, []);
+  return <>{props.children}</>;
+}
+
+function startRouter(unmount: () => void) {
+  const router: Router = {
+    navigate: (href, options) => go(new URL(href, location.href), options?.replace ? "replace" : "push"),
+    unmount,
+    navigation: 0,
+    location: new URL(location.href),
+  };
+  window.__alloy = router;
+
+  prefetchConfig = window.ALLOY_PREFETCH ?? prefetchConfig;
+  startPrefetching();
+
+  history.scrollRestoration = "manual";
+  document.addEventListener("click", onClick);
+  document.addEventListener("submit", onSubmit, true);
+  window.addEventListener("popstate", (event) => {
+    const url = new URL(location.href);
+    if (url.pathname === router.location.pathname && url.search === router.location.search) {
+      // Only the hash changed; the browser scrolls to it.
+      router.location = url;
+      return;
+    }
+    go(url, "pop", event.state?.scroll);
+  });
+  window.addEventListener("pagehide", saveScroll);
+}
+
+function onClick(event: MouseEvent) {
+  if (event.defaultPrevented || event.button !== 0 || event.metaKey || event.ctrlKey || event.shiftKey || event.altKey) {
+    return;
+  }
+  const url = linkURL(event.target);
+  if (!url || (url.pathname === location.pathname && url.search === location.search && url.hash)) {
+    return;
+  }
+
+  event.preventDefault();
+  window.__alloy!.navigate(url.href);
+}
+
+// onSubmit sets the CSRF token of same-origin forms posted with the browser, adding its
+// field when the form lacks one.
+function onSubmit(event: SubmitEvent) {
+  const form = event.target as HTMLFormElement;
+  const config = window.ALLOY_CSRF;
+  if (!config || form.method !== "post" || new URL(form.action, location.href).origin !== location.origin) {
+    return;
+  }
+  let input = form.querySelector(`input[name="${CSS.escape(config.field)}"]`) as HTMLInputElement | null;
+  if (!input) {
+    input = document.createElement("input");
+    input.type = "hidden";
+    input.name = config.field;
+    form.appendChild(input);
+  }
+  input.value = csrfToken();
+}
+
+// linkAnchor returns the link target is in, if the router handles it.
+function linkAnchor(target: EventTarget | null): HTMLAnchorElement | null {
+  const anchor = (target as Element | null)?.closest?.("a[href]") as HTMLAnchorElement | null;
+  if (!anchor || (anchor.target && anchor.target !== "_self") || anchor.hasAttribute("download") || anchor.hasAttribute("data-alloy-reload")) {
+    return null;
+  }
+  const url = new URL(anchor.href, location.href);
+  return url.origin === location.origin && isPageRoute(url.pathname) ? anchor : null;
+}
+
+// isPageRoute reports whether pathname matches the route of a page, such as
+// "/blog/:slug", and so has a data endpoint. Without the route list, every path does.
+function isPageRoute(pathname: string): boolean {
+  const routes = window.ALLOY_ROUTES;
+  if (!routes) {
+    return true;
+  }
+  const segments = pathname.replace(/(.)\/$/, "$1").split("/");
+  return routes.some((route) => {
+    const parts = route.split("/");
+    for (let i = 0; i < parts.length; i++) {
+      if (parts[i].startsWith("*")) {
+        return true;
+      }
+      if (i >= segments.length || (parts[i].startsWith(":") ? !segments[i] : parts[i] !== segments[i])) {
+        return false;
+      }
+    }
+    return parts.length === segments.length;
+  });
+}
+
+function linkURL(target: EventTarget | null): URL | null {
+  const anchor = linkAnchor(target);
+  return anchor ? new URL(anchor.href, location.href) : null;
+}
+
+// startPrefetching prefetches linked pages by their data-alloy-prefetch attribute, or
+// the engine's Prefetch option: on hover or focus, when they scroll into view, or as
+// soon as they are rendered.
+function startPrefetching() {
+  const onIntent = (event: Event) => {
+    const anchor = linkAnchor(event.target);
+    if (anchor && strategyOf(anchor) === "hover") {
+      prefetch(anchor);
+    }
+  };
+  document.addEventListener("mouseover", onIntent, { passive: true });
+  document.addEventListener("focusin", onIntent, { passive: true });
+  document.addEventListener("touchstart", onIntent, { passive: true });
+
+  const viewport =
+    "IntersectionObserver" in window
+      ? new IntersectionObserver((entries) => {
+          for (const entry of entries) {
+            if (entry.isIntersecting) {
+              viewport!.unobserve(entry.target);
+              prefetch(entry.target as HTMLAnchorElement);
+            }
+          }
+        })
+      : null;
+
+  const seen = new WeakSet<Element>();
+  let scheduled = false;
+  const scan = () => {
+    scheduled = false;
+    document.querySelectorAll("a[href]").forEach((element) => {
+      const anchor = linkAnchor(element);
+      if (!anchor || seen.has(anchor)) {
+        return;
+      }
+      seen.add(anchor);
+      const strategy = strategyOf(anchor);
+      if (strategy === "eager") {
+        prefetch(anchor);
+      } else if (strategy === "viewport" && viewport) {
+        viewport.observe(anchor);
+      } else if (strategy === "viewport") {
+        prefetch(anchor);
+      }
+    });
+  };
+  const schedule = () => {
+    if (!scheduled) {
+      scheduled = true;
+      (window.requestIdleCallback ?? setTimeout)(scan);
+    }
+  };
+
+  schedule();
+  new MutationObserver(schedule).observe(document.body, { childList: true, subtree: true });
+}
+
+function strategyOf(anchor: HTMLAnchorElement): PrefetchStrategy {
+  return (anchor.getAttribute("data-alloy-prefetch") as PrefetchStrategy | null) || prefetchConfig.strategy;
+}
+
+// prefetch loads the bundles of the page anchor links to, and its loader data when
+// the engine prefetches data.
+function prefetch(anchor: HTMLAnchorElement) {
+  const url = new URL(anchor.href, location.href);
+  if (url.pathname === location.pathname && url.search === location.search) {
+    return;
+  }
+  const key = dataURL(url);
+
+  if (prefetchConfig.data) {
+    const entry = prefetched.get(key);
+    if (entry && Date.now() - entry.at < prefetchedDataTTL) {
+      return;
+    }
+    const data = fetchData(url, false);
+    data.then(preloadAssets, () => prefetched.delete(key));
+    prefetched.set(key, { data, at: Date.now() });
+    return;
+  }
+
+  if (!prefetchedAssets.has(key)) {
+    prefetchedAssets.add(key);
+    fetchData(url, true).then(preloadAssets, () => prefetchedAssets.delete(key));
+  }
+}
+
+// takePrefetched returns the loader data prefetched for url, if it is fresh enough.
+function takePrefetched(url: URL): Promise<PageData> | undefined {
+  const key = dataURL(url);
+  const entry = prefetched.get(key);
+  prefetched.delete(key);
+  return entry && Date.now() - entry.at < prefetchedDataTTL ? entry.data : undefined;
+}
+
+async function fetchData(url: URL, assetsOnly: boolean): Promise<PageData> {
+  const headers: Record<string, string> = { Accept: "application/json" };
+  if (assetsOnly) {
+    headers["X-Alloy-Prefetch"] = "assets";
+  }
+  const response = await fetch(dataURL(url), { headers, redirect: "manual" });
+  if (response.status !== 200 || !response.headers.get("Content-Type")?.includes("application/json")) {
+    throw new Error(`unexpected response ${response.status}`);
+  }
+  return response.json();
+}
+
+// preloadAssets hints the browser to fetch a page's module and stylesheet.
+function preloadAssets(data: PageData) {
+  const hint = (rel: string, href: string, as?: string) => {
+    if (!href || document.querySelector(`link[rel="${rel}"][href="${CSS.escape(href)}"]`)) {
+      return;
+    }
+    const link = document.createElement("link");
+    link.rel = rel;
+    link.href = href;
+    if (as) {
+      link.as = as;
+    }
+    document.head.appendChild(link);
+  };
+  hint("modulepreload", data.module);
+  hint("preload", data.css, "style");
+}
+
+// dataURL returns the data endpoint of the page at url, e.g. /_alloy/data/blog/hello.json.
+function dataURL(url: URL): string {
+  const path = url.pathname === "/" ? "/index" : url.pathname.replace(/\/$/, "");
+  return dataPrefix + path + ".json" + url.search;
+}
+
+async function go(url: URL, mode: "push" | "replace" | "pop", scroll?: Scroll) {
+  const router = window.__alloy!;
+  const navigation = ++router.navigation;
+
+  let data: PageData;
+  let page: PageModule;
+  try {
+    const prefetchedData = takePrefetched(url);
+    data = await (prefetchedData ? prefetchedData.catch(() => fetchData(url, false)) : fetchData(url, false));
+    [page] = await Promise.all([import(data.module), loadStylesheet(data.css)]);
+  } catch {
+    // Redirects, errors and routes that are not pages are left to the server.
+    if (navigation !== router.navigation) {
+      return;
+    }
+    if (mode === "pop") {
+      location.reload();
+    } else {
+      location.assign(url.href);
+    }
+    return;
+  }
+  if (navigation !== router.navigation) {
+    return;
+  }
+
+  if (mode !== "pop") {
+    saveScroll();
+    history[mode === "push" ? "pushState" : "replaceState"]({}, "", url.href);
+  }
+  router.location = url;
+  document.querySelectorAll(`link[data-alloy-css]:not([href="${CSS.escape(data.css)}"])`).forEach((link) => link.remove());
+  if (data.title) {
+    document.title = data.title;
+  }
+
+  await page.render(data.props);
+
+  if (scroll) {
+    window.scrollTo(scroll[0], scroll[1]);
+  } else if (url.hash) {
+    document.getElementById(decodeURIComponent(url.hash.slice(1)))?.scrollIntoView();
+  } else {
+    window.scrollTo(0, 0);
+  }
+}
+
+// saveScroll records the scroll position in the current history entry, for popstate.
+function saveScroll() {
+  history.replaceState({ ...history.state, scroll: [window.scrollX, window.scrollY] }, "");
+}
+
+// loadStylesheet adds the page's stylesheet and resolves once it applies.
+function loadStylesheet(href: string): Promise<void> {
+  if (!href || document.querySelector(`link[data-alloy-css][href="${CSS.escape(href)}"]`)) {
+    return Promise.resolve();
+  }
+  return new Promise((resolve) => {
+    const link = document.createElement("link");
+    link.rel = "stylesheet";
+    link.href = href;
+    link.setAttribute("data-alloy-css", "");
+    link.onload = link.onerror = () => resolve();
+    document.head.appendChild(link);
+  });
+}
@@ -0,0 +1,22 @@
+// The Alloy islands runtime, imported by the generated island entries as "alloy/islands".
+//
+// Pages in islands mode load no page bundle. Each island rendered on the page loads its
+// own entry, which hydrates its markers as separate React roots.
+import React from "react";
+
+// hydrateIslands hydrates the markers of the island whose entry is src with Component
+// and the props recorded on them. Markers inside another island are hydrated as part
+// of it.
+export function hydrateIslands(
+  ReactDOM: typeof import("react-dom/client"),
+  src: string,
+  Component: React.ComponentType<any>,
+) {
+  document.querySelectorAll(`alloy-island[data-src="${CSS.escape(src)}"]`).forEach((element) => {
+    if (element.parentElement?.closest("alloy-island")) {
+      return;
+    }
+    const props = JSON.parse(element.getAttribute("data-props") || "{}");
+    ReactDOM.hydrateRoot(element, <Component {...props} />);
+  });
+}
@@ -7,6 +7,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+
+	"github.com/bertilxi/alloy/cli"
 )
 
 func BuildCmd(args []string) {
@@ -73,6 +75,11 @@ func runBuild(dir, output string) error {
 	}
 	defer os.Chdir(originalDir)
 
+	// Regenerate the registry so the programs see every registry they reference
+	if err := cli.GenerateLoaders("pages"); err != nil {
+		return err
+	}
+
 	// Run the temporary build program (use -mod=mod to allow building from temp directory)
 	cmd := exec.Command("go", "run", "-mod=mod", tempFile)
 	cmd.Stdout = os.Stdout
@@ -146,10 +153,12 @@ var EmbedFS embed.FS
 
 func main() {
 	options := alloy.Options{
-		EmbedFS:  &EmbedFS,
-		Title:    "My Alloy App",
-		Loaders:  pages.LoaderRegistry,
-		Handlers: pages.HandlerRegistry,
+		EmbedFS:       &EmbedFS,
+		Title:         "My Alloy App",
+		Loaders:       pages.LoaderRegistry,
+		Handlers:      pages.HandlerRegistry,
+		LayoutLoaders: pages.LayoutLoaderRegistry,
+		Actions:       pages.ActionRegistry,
 	}
 	if err := cli.Build(alloy.New(options)); err != nil {
 		panic(err)
@@ -173,10 +182,12 @@ var EmbedFS embed.FS
 func main() {
 	alloy.SetProduction(true)
 	options := alloy.Options{
-		EmbedFS:  &EmbedFS,
-		Title:    "My Alloy App",
-		Loaders:  pages.LoaderRegistry,
-		Handlers: pages.HandlerRegistry,
+		EmbedFS:       &EmbedFS,
+		Title:         "My Alloy App",
+		Loaders:       pages.LoaderRegistry,
+		Handlers:      pages.HandlerRegistry,
+		LayoutLoaders: pages.LayoutLoaderRegistry,
+		Actions:       pages.ActionRegistry,
 	}
 	engine := alloy.New(options)
 	engine.Start()
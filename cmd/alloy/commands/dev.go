@@ -93,6 +93,11 @@ func loadEngine(dir string) (*alloy.Engine, error) {
 	}
 	defer os.Chdir(originalDir)
 
+	// Regenerate the registry so the program sees every registry it references
+	if err := cli.GenerateLoaders("pages"); err != nil {
+		return nil, err
+	}
+
 	// Run the temporary program (use -mod=mod to allow running from temp directory)
 	cmd := exec.Command("go", "run", "-mod=mod", tempFile)
 	cmd.Stdout = os.Stdout
@@ -134,10 +139,12 @@ import (
 
 func main() {
 	options := alloy.Options{
-		EmbedFS:  nil,
-		Title:    "My Alloy App",
-		Loaders:  pages.LoaderRegistry,
-		Handlers: pages.HandlerRegistry,
+		EmbedFS:       nil,
+		Title:         "My Alloy App",
+		Loaders:       pages.LoaderRegistry,
+		Handlers:      pages.HandlerRegistry,
+		LayoutLoaders: pages.LayoutLoaderRegistry,
+		Actions:       pages.ActionRegistry,
 	}
 	if err := cli.Dev(alloy.New(options)); err != nil {
 		panic(err)
@@ -0,0 +1,119 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/bertilxi/alloy/cli"
+)
+
+func ExportCmd(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dir := fs.String("dir", ".", "Project directory")
+	output := fs.String("output", "", "Output directory for the static site")
+
+	fs.Parse(args)
+
+	if err := runExport(*dir, *output); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Export error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runExport(dir, output string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("invalid directory: %w", err)
+	}
+
+	mainFilePath := filepath.Join(absDir, "main.go")
+	if _, err := os.Stat(mainFilePath); err != nil {
+		return fmt.Errorf("main.go not found in %s - are you in an Alloy project?", dir)
+	}
+
+	modContent, err := os.ReadFile(filepath.Join(absDir, "go.mod"))
+	if err != nil {
+		return fmt.Errorf("go.mod not found in %s", dir)
+	}
+
+	moduleName := parseModuleName(string(modContent))
+	if moduleName == "" {
+		return fmt.Errorf("could not parse module name from go.mod")
+	}
+
+	outputDir := output
+	if outputDir == "" {
+		outputDir = filepath.Join(absDir, "dist", "site")
+	}
+	outputDir, err = filepath.Abs(outputDir)
+	if err != nil {
+		return fmt.Errorf("invalid output directory: %w", err)
+	}
+
+	fmt.Printf("📁 Exporting project from: %s\n", absDir)
+
+	originalDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	if err := os.Chdir(absDir); err != nil {
+		return fmt.Errorf("failed to change directory: %w", err)
+	}
+	defer os.Chdir(originalDir)
+
+	// Regenerate the registry so the program sees every registry it references
+	if err := cli.GenerateLoaders("pages"); err != nil {
+		return err
+	}
+
+	tempDir, err := os.MkdirTemp("", "alloy-export-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	tempFile := filepath.Join(tempDir, "main.go")
+	if err := os.WriteFile(tempFile, []byte(generateExportProgram(moduleName, outputDir)), 0644); err != nil {
+		return fmt.Errorf("failed to write temp export program: %w", err)
+	}
+
+	cmd := exec.Command("go", "run", "-mod=mod", tempFile)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "Alloy_ENV=production")
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("export failed: %w", err)
+	}
+
+	fmt.Printf("✓ Static site exported: %s\n", outputDir)
+	return nil
+}
+
+func generateExportProgram(moduleName, outputDir string) string {
+	return fmt.Sprintf(`package main
+
+import (
+	"github.com/bertilxi/alloy"
+	"github.com/bertilxi/alloy/cli"
+	"%s/pages"
+)
+
+func main() {
+	options := alloy.Options{
+		Title:         "My Alloy App",
+		Loaders:       pages.LoaderRegistry,
+		Handlers:      pages.HandlerRegistry,
+		LayoutLoaders: pages.LayoutLoaderRegistry,
+		Paths:         pages.PathsRegistry,
+	}
+	if err := cli.Export(alloy.New(options), %q); err != nil {
+		panic(err)
+	}
+}
+`, moduleName, outputDir)
+}
@@ -63,6 +63,7 @@ func createProject(name string) error {
 		filepath.Join(projectDir, "styles.css"):                 stylesCssTemplate,
 		filepath.Join(projectDir, "go.mod"):                     goModTemplate,
 		filepath.Join(projectDir, "tsconfig.json"):              tsconfigTemplate,
+		filepath.Join(projectDir, "alloy.d.ts"):                 alloyTypesTemplate,
 		filepath.Join(projectDir, "package.json"):               packageJsonTemplate,
 		filepath.Join(projectDir, ".gitignore"):                 gitignoreTemplate,
 	}
@@ -197,6 +198,32 @@ const tsconfigTemplate = `{
 }
 `
 
+// alloyTypesTemplate declares the client runtime pages import as "alloy".
+const alloyTypesTemplate = `declare module "alloy" {
+  import type { AnchorHTMLAttributes, ReactElement, ReactNode } from "react";
+
+  /** Declares <title>, <meta> and <link> elements for the document head. */
+  export function Head(props: { children?: ReactNode }): null;
+
+  /** An anchor that overrides when the linked page is prefetched. */
+  export function Link(
+    props: AnchorHTMLAttributes<HTMLAnchorElement> & { prefetch?: "hover" | "viewport" | "eager" | "none" },
+  ): ReactElement;
+
+  /** Goes to href with client-side navigation. */
+  export function navigate(href: string, options?: { replace?: boolean }): Promise<void>;
+
+  /** A hidden input carrying the CSRF token, for forms posted without JavaScript. */
+  export function CSRFInput(): ReactElement | null;
+
+  /** The visitor's CSRF token in the browser, empty when protection is off. */
+  export function csrfToken(): string;
+
+  /** The header carrying the CSRF token, for fetch requests with unsafe methods. */
+  export function csrfHeaders(): Record<string, string>;
+}
+`
+
 const gitignoreTemplate = `.alloy/
 .alloy-cache/
 dist/
@@ -226,10 +253,12 @@ var EmbedFS embed.FS
 
 func main() {
 	options := alloy.Options{
-		EmbedFS:  &EmbedFS,
-		Title:    "My Alloy App",
-		Loaders:  pages.LoaderRegistry,
-		Handlers: pages.HandlerRegistry,
+		EmbedFS:       &EmbedFS,
+		Title:         "My Alloy App",
+		Loaders:       pages.LoaderRegistry,
+		Handlers:      pages.HandlerRegistry,
+		LayoutLoaders: pages.LayoutLoaderRegistry,
+		Actions:       pages.ActionRegistry,
 	}
 	engine := alloy.New(options)
 	if err := engine.Start(); err != nil {
@@ -264,6 +293,18 @@ var LoaderRegistry = map[string]alloy.PageLoader{
 var HandlerRegistry = map[string]gin.HandlerFunc{
 	"/api/hello": api.Hello,
 }
+
+// LayoutLoaderRegistry maps layout directory routes to the loaders of their _layout.tsx files.
+var LayoutLoaderRegistry = map[string]alloy.PageLoader{
+}
+
+// ActionRegistry maps page routes to the actions handling form POSTs to them.
+var ActionRegistry = map[string]alloy.PageAction{
+}
+
+// PathsRegistry maps dynamic page routes to the functions listing their params for static export.
+var PathsRegistry = map[string]alloy.PathsFunc{
+}
 `
 
 const apiHelloTemplate = `package api
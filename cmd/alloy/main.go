@@ -22,6 +22,8 @@ func main() {
 		commands.DevCmd(os.Args[2:])
 	case "build":
 		commands.BuildCmd(os.Args[2:])
+	case "export":
+		commands.ExportCmd(os.Args[2:])
 	case "install":
 		commands.InstallCmd(os.Args[2:])
 	case "new":
@@ -56,6 +58,9 @@ COMMANDS:
   build            Build for production
                    Usage: alloy build [--dir .] [--output ./dist/app]
 
+  export           Export a static site (dynamic routes need a paths function)
+                   Usage: alloy export [--dir .] [--output ./dist/site]
+
   new              Create a new Alloy project
                    Usage: alloy new <project-name>
 
@@ -66,7 +71,7 @@ COMMANDS:
 OPTIONS:
   --port <number>  Port for server (default: 8080)
   --dir <path>     Project directory (default: current directory)
-  --output <path>  Output binary path for build
+  --output <path>  Output binary path for build, or site directory for export
 
 EXAMPLES:
   # Create a new project
@@ -88,6 +93,9 @@ EXAMPLES:
   # Run production binary
   ./dist/app
 
+  # Export a static site
+  alloy export
+
 ━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━
 `)
 }
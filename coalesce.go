@@ -0,0 +1,96 @@
+package alloy
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/singleflight"
+)
+
+// CoalesceOptions makes concurrent requests for the same page share one loader and
+// SSR execution. The shared response (status, headers and body) is sent to every
+// waiting request, so the page must not depend on anything outside its key, such as
+// the user's session. A response that sets cookies is only sent to the request it was
+// rendered for; the others render their own. Streaming pages are buffered when coalesced.
+type CoalesceOptions struct {
+	// Query lists query parameters that distinguish requests. Others are ignored.
+	Query []string
+	// Headers lists request headers that distinguish requests.
+	Headers []string
+	// Key replaces the default key built from route params, Query and Headers.
+	Key func(c *gin.Context) string
+}
+
+// renderCoalesced renders c through the page's single-flight group.
+func (p *Page) renderCoalesced(c *gin.Context) {
+	key := p.Route
+	if p.Coalesce.Key != nil {
+		key += "\x00" + p.Coalesce.Key(c)
+	} else {
+		key = varyKey(p.Route, c, p.Coalesce.Query, p.Coalesce.Headers)
+	}
+
+	select {
+	case res := <-p.renderShared(c, key, nil):
+		p.writeShared(c, res.Val.(*recordedResponse))
+	case <-c.Request.Context().Done():
+		c.Abort()
+	}
+}
+
+// renderShared renders c into a buffer, sharing the execution with concurrent calls
+// for the same key. done, when set, runs once on the shared result.
+func (p *Page) renderShared(c *gin.Context, key string, done func(rc *gin.Context, response *recordedResponse)) <-chan singleflight.Result {
+	rc, recorder := recordingContext(c)
+	return p.flights.DoChan(key, func() (any, error) {
+		p.render(rc)
+		response := recorder.result()
+		response.renderedFor = c
+		if done != nil {
+			done(rc, response)
+		}
+		return response, nil
+	})
+}
+
+// writeShared sends the response of a shared render to c. A response setting cookies
+// belongs to the request it was rendered for; other waiters render their own.
+func (p *Page) writeShared(c *gin.Context, response *recordedResponse) {
+	if response.renderedFor != c && response.header.Get("Set-Cookie") != "" {
+		p.render(c)
+		return
+	}
+	response.writeTo(c)
+}
+
+// varyKey identifies a request to route by its params and the selected query
+// parameters and headers.
+func varyKey(route string, c *gin.Context, query, headers []string) string {
+	var sb strings.Builder
+	sb.WriteString(route)
+
+	params := make([]string, 0, len(c.Params))
+	for _, param := range c.Params {
+		params = append(params, param.Key+"="+param.Value)
+	}
+	sort.Strings(params)
+	for _, param := range params {
+		sb.WriteString("\x00")
+		sb.WriteString(param)
+	}
+
+	values := c.Request.URL.Query()
+	for _, name := range query {
+		sb.WriteString("\x00?")
+		sb.WriteString(url.Values{name: values[name]}.Encode())
+	}
+	for _, name := range headers {
+		sb.WriteString("\x00")
+		sb.WriteString(name)
+		sb.WriteString(":")
+		sb.WriteString(strings.Join(c.Request.Header.Values(name), ","))
+	}
+	return sb.String()
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSaturated is returned by Admission.Acquire when no render slot frees up in time.
+var ErrSaturated = errors.New("render capacity saturated")
+
+// AdmissionOptions configures an Admission controller.
+type AdmissionOptions struct {
+	// MaxConcurrent is the number of renders allowed to run at once.
+	MaxConcurrent int
+	// MaxQueue is the number of renders allowed to wait for a slot. Zero rejects
+	// as soon as every slot is busy.
+	MaxQueue int
+	// QueueTimeout bounds how long a render waits for a slot. Zero waits until the request ends.
+	QueueTimeout time.Duration
+}
+
+// AdmissionStats is a snapshot of an Admission controller, for tuning its limits.
+type AdmissionStats struct {
+	// InFlight and Queued are the renders running and waiting right now.
+	InFlight int
+	Queued   int
+	// Admitted and Rejected count renders since startup.
+	Admitted uint64
+	Rejected uint64
+	// TotalWait and MaxWait cover the time admitted renders spent queued.
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+// AverageWait is the mean queue time of admitted renders.
+func (s AdmissionStats) AverageWait() time.Duration {
+	if s.Admitted == 0 {
+		return 0
+	}
+	return s.TotalWait / time.Duration(s.Admitted)
+}
+
+// Admission bounds concurrent renders with a fixed number of slots and a bounded wait queue.
+type Admission struct {
+	options AdmissionOptions
+	slots   chan struct{}
+
+	queued    atomic.Int64
+	admitted  atomic.Uint64
+	rejected  atomic.Uint64
+	totalWait atomic.Int64
+	maxWait   atomic.Int64
+
+	// onQueued, when set, is called as a render starts waiting for a slot.
+	onQueued func()
+}
+
+// NewAdmission returns a controller allowing options.MaxConcurrent renders at once.
+func NewAdmission(options AdmissionOptions) *Admission {
+	if options.MaxConcurrent <= 0 {
+		options.MaxConcurrent = 1
+	}
+	return &Admission{
+		options: options,
+		slots:   make(chan struct{}, options.MaxConcurrent),
+	}
+}
+
+// Acquire waits for a render slot. It returns ErrSaturated when the queue is full or the
+// queue timeout passes, and ctx's error when the request ends first. Call release once
+// the render is done.
+func (a *Admission) Acquire(ctx context.Context) (release func(), err error) {
+	select {
+	case a.slots <- struct{}{}:
+		a.admit(0)
+		return a.release, nil
+	default:
+	}
+
+	if a.queued.Add(1) > int64(a.options.MaxQueue) {
+		a.queued.Add(-1)
+		a.rejected.Add(1)
+		return nil, ErrSaturated
+	}
+	defer a.queued.Add(-1)
+
+	var timeout <-chan time.Time
+	if a.options.QueueTimeout > 0 {
+		timer := time.NewTimer(a.options.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	start := time.Now()
+	if a.onQueued != nil {
+		a.onQueued()
+	}
+	select {
+	case a.slots <- struct{}{}:
+		a.admit(time.Since(start))
+		return a.release, nil
+	case <-timeout:
+		a.rejected.Add(1)
+		return nil, ErrSaturated
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (a *Admission) admit(wait time.Duration) {
+	a.admitted.Add(1)
+	a.totalWait.Add(int64(wait))
+	for {
+		current := a.maxWait.Load()
+		if int64(wait) <= current || a.maxWait.CompareAndSwap(current, int64(wait)) {
+			return
+		}
+	}
+}
+
+func (a *Admission) release() {
+	<-a.slots
+}
+
+// RetryAfter suggests how long a rejected client should wait before retrying.
+func (a *Admission) RetryAfter() time.Duration {
+	return max(a.options.QueueTimeout.Round(time.Second), time.Second)
+}
+
+// Stats returns the controller's current queue depth and wait times.
+func (a *Admission) Stats() AdmissionStats {
+	return AdmissionStats{
+		InFlight:  len(a.slots),
+		Queued:    int(a.queued.Load()),
+		Admitted:  a.admitted.Load(),
+		Rejected:  a.rejected.Load(),
+		TotalWait: time.Duration(a.totalWait.Load()),
+		MaxWait:   time.Duration(a.maxWait.Load()),
+	}
+}
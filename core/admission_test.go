@@ -0,0 +1,84 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAdmission(t *testing.T) {
+	admission := NewAdmission(AdmissionOptions{MaxConcurrent: 1, MaxQueue: 1})
+	waiting := make(chan struct{})
+	admission.onQueued = func() { close(waiting) }
+
+	release, err := admission.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One render may queue; a second is shed immediately.
+	queued := make(chan error, 1)
+	go func() {
+		release, err := admission.Acquire(context.Background())
+		if err == nil {
+			release()
+		}
+		queued <- err
+	}()
+	<-waiting
+	if _, err := admission.Acquire(context.Background()); !errors.Is(err, ErrSaturated) {
+		t.Fatalf("expected ErrSaturated for a full queue, got %v", err)
+	}
+	if stats := admission.Stats(); stats.InFlight != 1 || stats.Queued != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	release()
+	if err := <-queued; err != nil {
+		t.Fatalf("queued render was not admitted: %v", err)
+	}
+
+	stats := admission.Stats()
+	if stats.InFlight != 0 || stats.Admitted != 2 || stats.Rejected != 1 || stats.MaxWait <= 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestAdmissionQueueTimeout(t *testing.T) {
+	admission := NewAdmission(AdmissionOptions{MaxConcurrent: 1, MaxQueue: 1, QueueTimeout: time.Millisecond})
+
+	release, err := admission.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	// The slot is never released, so the queued render times out.
+	if _, err := admission.Acquire(context.Background()); !errors.Is(err, ErrSaturated) {
+		t.Fatalf("expected ErrSaturated after the queue timeout, got %v", err)
+	}
+	if stats := admission.Stats(); stats.Admitted != 1 || stats.Rejected != 1 || stats.Queued != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestAdmissionCanceled(t *testing.T) {
+	admission := NewAdmission(AdmissionOptions{MaxConcurrent: 1, MaxQueue: 1})
+
+	release, err := admission.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	// A request ending while queued is neither admitted nor counted as rejected.
+	ctx, cancel := context.WithCancel(context.Background())
+	admission.onQueued = cancel
+	if _, err := admission.Acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if stats := admission.Stats(); stats.Admitted != 1 || stats.Rejected != 0 || stats.Queued != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
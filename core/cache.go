@@ -1,18 +1,36 @@
 package core
 
 import (
+	"container/list"
 	"embed"
+	"encoding/json"
+	"net/http"
 	"os"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var bundleCache sync.Map
 
+// bundleGeneration counts the calls to ClearBundleCache.
+var bundleGeneration atomic.Uint64
+
 func ClearBundleCache() {
 	bundleCache.Range(func(key, value interface{}) bool {
 		bundleCache.Delete(key)
 		return true
 	})
+	ClearSourceMapCache()
+	ClearSSRPools()
+	bundleGeneration.Add(1)
+}
+
+// BundleGeneration changes whenever the bundle cache is cleared, so values derived
+// from bundles can be cached until then.
+func BundleGeneration() uint64 {
+	return bundleGeneration.Load()
 }
 
 type BundleReader interface {
@@ -55,3 +73,138 @@ func GetClientBundles(reader BundleReader, jsKey, cssKey string) (string, string
 
 	return jsKey, cssKey, nil
 }
+
+// GetClientChunks returns the shared chunks a page's client bundle imports, from the
+// manifest the client build writes next to it, or none when there is no manifest.
+func GetClientChunks(reader BundleReader, cacheKey string) []string {
+	if val, ok := bundleCache.Load(cacheKey); ok {
+		return val.([]string)
+	}
+
+	manifest, err := reader.ReadBundle(cacheKey)
+	if err != nil {
+		return nil
+	}
+	var chunks []string
+	if err := json.Unmarshal(manifest, &chunks); err != nil {
+		return nil
+	}
+	bundleCache.Store(cacheKey, chunks)
+	return chunks
+}
+
+// CachedPage is a rendered document kept by a PageStore.
+type CachedPage struct {
+	// Route is the page's route pattern, e.g. "/blog/:slug".
+	Route  string
+	Tags   []string
+	Status int
+	Header http.Header
+	Body   []byte
+
+	StoredAt time.Time
+	// The page is served as is until FreshUntil, and served while being
+	// regenerated until StaleUntil.
+	FreshUntil time.Time
+	StaleUntil time.Time
+}
+
+// PageStore keeps rendered documents for Page.Cache. Implementations must be safe
+// for concurrent use; NewMemoryPageStore is the default.
+type PageStore interface {
+	Get(key string) (*CachedPage, bool)
+	Set(key string, page *CachedPage)
+	// PurgeRoute drops every document rendered for the route pattern.
+	PurgeRoute(route string)
+	// PurgeTag drops every document carrying tag.
+	PurgeTag(tag string)
+}
+
+// DefaultPageStoreSize is the number of documents kept by the default page store.
+const DefaultPageStoreSize = 1000
+
+// MemoryPageStore is an in-memory PageStore that evicts the least recently used documents.
+type MemoryPageStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List
+}
+
+type memoryPageEntry struct {
+	key  string
+	page *CachedPage
+}
+
+// NewMemoryPageStore returns a store holding at most maxEntries documents.
+func NewMemoryPageStore(maxEntries int) *MemoryPageStore {
+	if maxEntries <= 0 {
+		maxEntries = DefaultPageStoreSize
+	}
+	return &MemoryPageStore{
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		order:      list.New(),
+	}
+}
+
+func (s *MemoryPageStore) Get(key string) (*CachedPage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	page := elem.Value.(*memoryPageEntry).page
+	if time.Now().After(page.StaleUntil) {
+		s.remove(elem)
+		return nil, false
+	}
+	s.order.MoveToFront(elem)
+	return page, true
+}
+
+func (s *MemoryPageStore) Set(key string, page *CachedPage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.entries[key]; ok {
+		elem.Value.(*memoryPageEntry).page = page
+		s.order.MoveToFront(elem)
+		return
+	}
+
+	s.entries[key] = s.order.PushFront(&memoryPageEntry{key: key, page: page})
+	for s.order.Len() > s.maxEntries {
+		s.remove(s.order.Back())
+	}
+}
+
+func (s *MemoryPageStore) PurgeRoute(route string) {
+	s.purge(func(page *CachedPage) bool {
+		return page.Route == route
+	})
+}
+
+func (s *MemoryPageStore) PurgeTag(tag string) {
+	s.purge(func(page *CachedPage) bool {
+		return slices.Contains(page.Tags, tag)
+	})
+}
+
+func (s *MemoryPageStore) purge(match func(page *CachedPage) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, elem := range s.entries {
+		if match(elem.Value.(*memoryPageEntry).page) {
+			s.remove(elem)
+		}
+	}
+}
+
+func (s *MemoryPageStore) remove(elem *list.Element) {
+	s.order.Remove(elem)
+	delete(s.entries, elem.Value.(*memoryPageEntry).key)
+}
@@ -0,0 +1,38 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryPageStore(t *testing.T) {
+	store := NewMemoryPageStore(2)
+	now := time.Now()
+	page := func(route string, tags ...string) *CachedPage {
+		return &CachedPage{Route: route, Tags: tags, StaleUntil: now.Add(time.Hour)}
+	}
+
+	store.Set("a", page("/a", "posts"))
+	store.Set("b", page("/b"))
+	store.Get("a")
+	store.Set("c", page("/c", "posts"))
+	if _, ok := store.Get("b"); ok {
+		t.Fatal("expected the least recently used entry to be evicted")
+	}
+
+	store.PurgeTag("posts")
+	if _, ok := store.Get("a"); ok {
+		t.Fatal("expected tagged entry to be purged")
+	}
+
+	store.Set("d", page("/d"))
+	store.PurgeRoute("/d")
+	if _, ok := store.Get("d"); ok {
+		t.Fatal("expected route entry to be purged")
+	}
+
+	store.Set("e", &CachedPage{Route: "/e", StaleUntil: now.Add(-time.Second)})
+	if _, ok := store.Get("e"); ok {
+		t.Fatal("expected expired entry to be dropped")
+	}
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// NewConsoleLogger returns the default logger for console output from server bundles.
+// Development pretty-prints to stderr; production writes JSON records at or above level.
+func NewConsoleLogger(dev bool, level slog.Level) *slog.Logger {
+	if dev {
+		return slog.New(newPrettyHandler(os.Stderr, slog.LevelDebug))
+	}
+	return slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+}
+
+var consoleLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"log":   slog.LevelInfo,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// prettyHandler is a slog.Handler for development that prints one readable line per record.
+type prettyHandler struct {
+	mu    *sync.Mutex
+	out   io.Writer
+	level slog.Leveler
+	attrs []slog.Attr
+}
+
+func newPrettyHandler(out io.Writer, level slog.Leveler) *prettyHandler {
+	return &prettyHandler{mu: &sync.Mutex{}, out: out, level: level}
+}
+
+func (h *prettyHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *prettyHandler) Handle(_ context.Context, r slog.Record) error {
+	icon := "💬"
+	switch {
+	case r.Level >= slog.LevelError:
+		icon = "❌"
+	case r.Level >= slog.LevelWarn:
+		icon = "⚠️ "
+	case r.Level < slog.LevelInfo:
+		icon = "🐛"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s", icon, r.Message)
+
+	var fields []string
+	appendAttr := func(a slog.Attr) bool {
+		if a.Key != "source" && a.Value.String() != "" {
+			fields = append(fields, fmt.Sprintf("%s=%s", a.Key, a.Value))
+		}
+		return true
+	}
+	for _, a := range h.attrs {
+		appendAttr(a)
+	}
+	r.Attrs(appendAttr)
+	if len(fields) > 0 {
+		fmt.Fprintf(&sb, "  \033[2m%s\033[0m", strings.Join(fields, " "))
+	}
+	sb.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.out, sb.String())
+	return err
+}
+
+func (h *prettyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	next.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return &next
+}
+
+func (h *prettyHandler) WithGroup(name string) slog.Handler {
+	// Groups are flattened; SSR console records only carry a few top-level attributes.
+	return h
+}
@@ -7,9 +7,59 @@ import (
 	"strings"
 )
 
+const (
+	// LayoutFile is the name of the layout files that wrap every page in their directory and below.
+	LayoutFile = "_layout.tsx"
+	// DocumentFile is the name of the page, at the root of the pages directory, that
+	// replaces the default document shell.
+	DocumentFile = "_document.tsx"
+	// AppFile is the name of the component, at the root of the pages directory, that
+	// wraps every page.
+	AppFile = "_app.tsx"
+	// ErrorFile is the name of the page, at the root of the pages directory, rendered
+	// when a request fails.
+	ErrorFile = "_error.tsx"
+	// NotFoundFile is the name of the page, at the root of the pages directory, rendered
+	// with status 404 for unknown routes. It is not a route itself.
+	NotFoundFile = "404.tsx"
+	// NotFoundRoute is the would-be route of pages/404.tsx, its loader's key.
+	NotFoundRoute = "/404"
+	// IslandSuffix marks components hydrated on their own as client islands, e.g.
+	// Counter.island.tsx. They are never pages, even inside the pages directory.
+	IslandSuffix = ".island.tsx"
+)
+
+// SourceDirs are the directories, besides the pages directory, searched for client
+// islands.
+var SourceDirs = []string{"components", "src", "lib"}
+
 type PageInfo struct {
 	Route string
 	File  string
+	// Layouts wrap the page, outermost first.
+	Layouts []LayoutInfo
+	// App is the project's _app.tsx, empty if it has none.
+	App string
+}
+
+// LayoutInfo is a _layout.tsx file. Route is the route of its directory, e.g. "/blog".
+type LayoutInfo struct {
+	Route string
+	File  string
+}
+
+// isSpecialFile reports whether a .tsx file in the pages tree has a framework role
+// instead of being a page. Layouts and islands have it at any depth; _app, _document,
+// _error and 404 only at the root of the pages directory.
+func isSpecialFile(absPageDir, path string) bool {
+	name := filepath.Base(path)
+	if name == LayoutFile || strings.HasSuffix(name, IslandSuffix) {
+		return true
+	}
+	if filepath.Dir(path) != absPageDir {
+		return false
+	}
+	return name == DocumentFile || name == AppFile || name == ErrorFile || name == NotFoundFile
 }
 
 func DiscoverPageFiles(pagesDir string) ([]PageInfo, error) {
@@ -23,6 +73,7 @@ func DiscoverPageFiles(pagesDir string) ([]PageInfo, error) {
 	}
 
 	var pages []PageInfo
+	app := discoverApp(pagesDir)
 
 	err = filepath.Walk(absPageDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -33,7 +84,7 @@ func DiscoverPageFiles(pagesDir string) ([]PageInfo, error) {
 			return nil
 		}
 
-		if !strings.HasSuffix(path, ".tsx") {
+		if !strings.HasSuffix(path, ".tsx") || isSpecialFile(absPageDir, path) {
 			return nil
 		}
 
@@ -46,8 +97,10 @@ func DiscoverPageFiles(pagesDir string) ([]PageInfo, error) {
 		relPath = filepath.Join(pagesDir, relPath)
 
 		page := PageInfo{
-			Route: route,
-			File:  relPath,
+			Route:   route,
+			File:    relPath,
+			Layouts: discoverLayouts(pagesDir, absPageDir, filepath.Dir(path)),
+			App:     app,
 		}
 
 		pages = append(pages, page)
@@ -61,6 +114,118 @@ func DiscoverPageFiles(pagesDir string) ([]PageInfo, error) {
 	return pages, nil
 }
 
+// DiscoverErrorPageFile returns the project's _error.tsx. It is not a route, but is
+// wrapped in _app.tsx like one; its loader is registered under its would-be route.
+func DiscoverErrorPageFile(pagesDir string) (PageInfo, bool) {
+	file := filepath.Join(pagesDir, ErrorFile)
+	if _, err := os.Stat(file); err != nil {
+		return PageInfo{}, false
+	}
+	return PageInfo{
+		Route: "/" + strings.TrimSuffix(ErrorFile, ".tsx"),
+		File:  file,
+		App:   discoverApp(pagesDir),
+	}, true
+}
+
+// DiscoverNotFoundPageFile returns the project's 404.tsx. It is not a route, so /404
+// answers with status 404 too, but is wrapped in the root layouts and _app.tsx like one.
+func DiscoverNotFoundPageFile(pagesDir string) (PageInfo, bool) {
+	file := filepath.Join(pagesDir, NotFoundFile)
+	if _, err := os.Stat(file); err != nil {
+		return PageInfo{}, false
+	}
+	absPageDir, err := filepath.Abs(pagesDir)
+	if err != nil {
+		return PageInfo{}, false
+	}
+	return PageInfo{
+		Route:   NotFoundRoute,
+		File:    file,
+		Layouts: discoverLayouts(pagesDir, absPageDir, absPageDir),
+		App:     discoverApp(pagesDir),
+	}, true
+}
+
+// DiscoverIslandFiles lists the client islands in the pages directory and the
+// SourceDirs, skipping node_modules and hidden directories.
+func DiscoverIslandFiles(pagesDir string) ([]string, error) {
+	var islands []string
+	for _, root := range append([]string{pagesDir}, SourceDirs...) {
+		if _, err := os.Stat(root); err != nil {
+			continue
+		}
+		err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != root && (d.Name() == "node_modules" || strings.HasPrefix(d.Name(), ".")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(d.Name(), IslandSuffix) {
+				islands = append(islands, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover islands: %w", err)
+		}
+	}
+	return islands, nil
+}
+
+func discoverApp(pagesDir string) string {
+	app := filepath.Join(pagesDir, AppFile)
+	if _, err := os.Stat(app); err != nil {
+		return ""
+	}
+	return app
+}
+
+// discoverLayouts lists the layouts from absPageDir down to dir, outermost first.
+func discoverLayouts(pagesDir, absPageDir, dir string) []LayoutInfo {
+	rel, err := filepath.Rel(absPageDir, dir)
+	if err != nil {
+		return nil
+	}
+
+	dirs := []string{absPageDir}
+	if rel != "." {
+		for _, part := range strings.Split(rel, string(filepath.Separator)) {
+			dirs = append(dirs, filepath.Join(dirs[len(dirs)-1], part))
+		}
+	}
+
+	var layouts []LayoutInfo
+	for _, dir := range dirs {
+		path := filepath.Join(dir, LayoutFile)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		relPath, _ := filepath.Rel(absPageDir, path)
+		layouts = append(layouts, LayoutInfo{
+			Route: LayoutRoute(FilePathToRoute(path, absPageDir)),
+			File:  filepath.Join(pagesDir, relPath),
+		})
+	}
+	return layouts
+}
+
+// LayoutRoute turns the route of a _layout file, e.g. "/blog/_layout", into the route
+// of the directory it applies to, e.g. "/blog". Discovered layouts and the generated
+// LayoutLoaderRegistry are both keyed by it.
+func LayoutRoute(route string) string {
+	route = strings.TrimSuffix(route, "/_layout")
+	if route == "" {
+		return "/"
+	}
+	return route
+}
+
 func FilePathToRoute(filePath string, pagesDir string) string {
 	relativePath := strings.TrimPrefix(filePath, pagesDir)
 	relativePath = strings.TrimPrefix(relativePath, string(filepath.Separator))
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiscoverPageFilesSpecialFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for _, file := range []string{
+		"pages/_app.tsx",
+		"pages/_document.tsx",
+		"pages/404.tsx",
+		"pages/_layout.tsx",
+		"pages/index.tsx",
+		"pages/blog/_layout.tsx",
+		"pages/blog/[slug].tsx",
+		"pages/about/team.tsx",
+		"pages/admin/_error.tsx",
+		"pages/admin/404.tsx",
+		"pages/about/Counter.island.tsx",
+		"components/Toggle.island.tsx",
+		"node_modules/lib/Menu.island.tsx",
+		"scripts/Stray.island.tsx",
+	} {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pages, err := DiscoverPageFiles("pages")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := LayoutInfo{Route: "/", File: filepath.Join("pages", "_layout.tsx")}
+	blog := LayoutInfo{Route: "/blog", File: filepath.Join("pages", "blog", "_layout.tsx")}
+	want := map[string][]LayoutInfo{
+		"/":           {root},
+		"/blog/:slug": {root, blog},
+		"/about/team": {root},
+		// Only the root's _error.tsx and 404.tsx have a special role.
+		"/admin/_error": {root},
+		"/admin/404":    {root},
+	}
+
+	if len(pages) != len(want) {
+		t.Fatalf("expected %d pages, got %+v", len(want), pages)
+	}
+	for _, page := range pages {
+		if !reflect.DeepEqual(page.Layouts, want[page.Route]) {
+			t.Errorf("%s: got layouts %+v, want %+v", page.Route, page.Layouts, want[page.Route])
+		}
+		if page.App != filepath.Join("pages", "_app.tsx") {
+			t.Errorf("%s: got app %q", page.Route, page.App)
+		}
+	}
+
+	notFound, ok := DiscoverNotFoundPageFile("pages")
+	if !ok || notFound.Route != NotFoundRoute || !reflect.DeepEqual(notFound.Layouts, []LayoutInfo{root}) {
+		t.Errorf("got 404 page %+v", notFound)
+	}
+
+	islands, err := DiscoverIslandFiles("pages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantIslands := []string{filepath.Join("pages", "about", "Counter.island.tsx"), filepath.Join("components", "Toggle.island.tsx")}
+	if !reflect.DeepEqual(islands, wantIslands) {
+		t.Errorf("got islands %v, want %v", islands, wantIslands)
+	}
+}
@@ -9,6 +9,7 @@ type RenderError struct {
 	Step    string
 	Message string
 	Details string
+	Cause   error
 }
 
 func (e *RenderError) Error() string {
@@ -19,6 +20,46 @@ func (e *RenderError) Error() string {
 	return msg
 }
 
+func (e *RenderError) Unwrap() error {
+	return e.Cause
+}
+
+// JSError is an exception thrown by JavaScript while evaluating a bundle or rendering a page.
+type JSError struct {
+	Name    string
+	Message string
+	Stack   string
+	// Location and CodeFrame point at the original source when a source map is available.
+	Location  *SourcePosition
+	CodeFrame string
+}
+
+func (e *JSError) Error() string {
+	if e.Name == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Name, e.Message)
+}
+
+// Report formats the exception with its original location, code frame and stack for terminal output.
+func (e *JSError) Report() string {
+	var sb strings.Builder
+	sb.WriteString(e.Error())
+	sb.WriteString("\n")
+	if e.Location != nil {
+		fmt.Fprintf(&sb, "   at %s\n", e.Location)
+	}
+	if e.CodeFrame != "" {
+		sb.WriteString("\n")
+		sb.WriteString(e.CodeFrame)
+		sb.WriteString("\n")
+	}
+	if e.Stack != "" {
+		sb.WriteString(e.Stack)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
 func ExtractJSErrorContext(jsErr string) string {
 	jsErr = strings.TrimSpace(jsErr)
 	if strings.Contains(jsErr, "ReferenceError") {
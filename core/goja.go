@@ -0,0 +1,353 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dop251/goja"
+)
+
+// Goja runs bundles in goja, a JavaScript engine written in pure Go. It needs no cgo,
+// which makes it suitable for static cross-compiled binaries, but it is slower than
+// QuickJS and ignores RenderMemoryLimit. Timers run on a virtual clock: pending
+// setTimeout callbacks fire in order without waiting.
+var Goja JSEngine = gojaEngine{}
+
+// gojaProgramCounter matches the bytecode offset goja appends to stack frame positions.
+var gojaProgramCounter = regexp.MustCompile(`(:\d+:\d+)\(\d+\)`)
+
+type gojaEngine struct{}
+
+func (gojaEngine) Name() string { return "goja" }
+
+func (gojaEngine) Load(name, bundle string, options SSRPoolOptions) (func() (JSRuntime, error), error) {
+	program, err := goja.Compile(name, bundle, false)
+	if err != nil {
+		return nil, gojaError(context.Background(), err)
+	}
+
+	// Evaluate once so load errors surface when the pool is created.
+	rt, err := newGojaRuntime(program)
+	if err != nil {
+		return nil, err
+	}
+	rt.Close()
+
+	return func() (JSRuntime, error) {
+		return newGojaRuntime(program)
+	}, nil
+}
+
+type gojaRuntime struct {
+	vm            *goja.Runtime
+	jsonParse     goja.Callable
+	jsonStringify goja.Callable
+
+	// logger and write belong to the render in progress, if any.
+	logger *slog.Logger
+	write  func(chunk []byte) error
+	err    error
+
+	timers    []gojaTimer
+	nextTimer int64
+	now       int64
+}
+
+type gojaTimer struct {
+	id   int64
+	due  int64
+	fn   goja.Callable
+	args []goja.Value
+}
+
+func newGojaRuntime(program *goja.Program) (*gojaRuntime, error) {
+	r := &gojaRuntime{vm: goja.New()}
+
+	json := r.vm.Get("JSON").ToObject(r.vm)
+	r.jsonParse, _ = goja.AssertFunction(json.Get("parse"))
+	r.jsonStringify, _ = goja.AssertFunction(json.Get("stringify"))
+
+	r.installConsole()
+	r.installTimers()
+
+	if _, err := r.vm.RunProgram(program); err != nil {
+		return nil, gojaError(context.Background(), err)
+	}
+	return r, nil
+}
+
+func (r *gojaRuntime) Render(ctx context.Context, request RenderRequest) (RenderResult, error) {
+	defer r.begin(ctx, request)()
+
+	renderPage, ok := goja.AssertFunction(r.vm.Get("renderPage"))
+	if !ok {
+		return RenderResult{}, &JSError{Name: "TypeError", Message: "renderPage is not a function"}
+	}
+
+	props, contextVal, err := r.parseRequest(request)
+	if err != nil {
+		return RenderResult{}, gojaError(ctx, err)
+	}
+
+	res, err := renderPage(goja.Undefined(), props, contextVal)
+	if err != nil {
+		return RenderResult{}, gojaError(ctx, err)
+	}
+
+	object, ok := res.(*goja.Object)
+	if !ok {
+		return RenderResult{HTML: res.String()}, nil
+	}
+	html := object.Get("html")
+	if html == nil || goja.IsUndefined(html) || goja.IsNull(html) {
+		return RenderResult{}, &JSError{Name: "TypeError", Message: "renderPage returned an object without html"}
+	}
+	result := RenderResult{HTML: html.String()}
+	if head := object.Get("head"); head != nil && !goja.IsUndefined(head) && !goja.IsNull(head) {
+		result.Head = head.String()
+	}
+	return result, nil
+}
+
+func (r *gojaRuntime) RenderStream(ctx context.Context, request RenderRequest, write func(chunk []byte) error) error {
+	defer r.begin(ctx, request)()
+	r.write = write
+
+	renderPageStream, ok := goja.AssertFunction(r.vm.Get("renderPageStream"))
+	if !ok {
+		return &JSError{Name: "TypeError", Message: "renderPageStream is not a function"}
+	}
+
+	props, contextVal, err := r.parseRequest(request)
+	if err != nil {
+		return gojaError(ctx, err)
+	}
+
+	res, err := renderPageStream(goja.Undefined(), props, r.vm.ToValue(r.writeChunk), contextVal)
+	if err != nil {
+		return gojaError(ctx, err)
+	}
+
+	promise, ok := res.Export().(*goja.Promise)
+	if !ok {
+		return r.err
+	}
+
+	// Promise jobs run whenever a call returns; timers drive the rest.
+	for promise.State() == goja.PromiseStatePending {
+		ran, err := r.runTimer()
+		if err != nil {
+			return gojaError(ctx, err)
+		}
+		if !ran {
+			return &JSError{Name: "Error", Message: "renderPageStream never settled"}
+		}
+	}
+
+	if promise.State() == goja.PromiseStateRejected {
+		return gojaValueError(promise.Result())
+	}
+	return r.err
+}
+
+// parseRequest parses the request's props and context into JS values.
+func (r *gojaRuntime) parseRequest(request RenderRequest) (goja.Value, goja.Value, error) {
+	props, err := r.jsonParse(goja.Undefined(), r.vm.ToValue(request.Props))
+	if err != nil {
+		return nil, nil, err
+	}
+	contextVal, err := r.jsonParse(goja.Undefined(), r.vm.ToValue(requestContext(request)))
+	if err != nil {
+		return nil, nil, err
+	}
+	return props, contextVal, nil
+}
+
+// begin binds the runtime to a render and arranges for ctx to interrupt it.
+// The returned function must be called when the render finishes.
+func (r *gojaRuntime) begin(ctx context.Context, request RenderRequest) func() {
+	r.logger = request.Logger
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			r.vm.Interrupt(ctx.Err())
+		case <-done:
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+		r.vm.ClearInterrupt()
+		r.logger = nil
+		r.write = nil
+		r.err = nil
+		r.timers = nil
+	}
+}
+
+func (r *gojaRuntime) Close() {
+	r.timers = nil
+}
+
+func (r *gojaRuntime) writeChunk(call goja.FunctionCall) goja.Value {
+	if r.write == nil || r.err != nil {
+		return goja.Undefined()
+	}
+
+	arg := call.Argument(0)
+	chunk, ok := arg.Export().([]byte)
+	if !ok {
+		chunk = []byte(arg.String())
+	}
+	r.err = r.write(chunk)
+	return goja.Undefined()
+}
+
+func (r *gojaRuntime) installTimers() {
+	r.vm.Set("setTimeout", func(call goja.FunctionCall) goja.Value {
+		fn, ok := goja.AssertFunction(call.Argument(0))
+		if !ok {
+			panic(r.vm.NewTypeError("setTimeout callback is not a function"))
+		}
+		delay := call.Argument(1).ToInteger()
+		var args []goja.Value
+		if len(call.Arguments) > 2 {
+			args = append(args, call.Arguments[2:]...)
+		}
+
+		r.nextTimer++
+		r.timers = append(r.timers, gojaTimer{id: r.nextTimer, due: r.now + max(delay, 0), fn: fn, args: args})
+		return r.vm.ToValue(r.nextTimer)
+	})
+
+	r.vm.Set("clearTimeout", func(call goja.FunctionCall) goja.Value {
+		id := call.Argument(0).ToInteger()
+		for i, timer := range r.timers {
+			if timer.id == id {
+				r.timers = append(r.timers[:i], r.timers[i+1:]...)
+				break
+			}
+		}
+		return goja.Undefined()
+	})
+}
+
+// runTimer fires the earliest pending timer, advancing the virtual clock to it.
+func (r *gojaRuntime) runTimer() (bool, error) {
+	if len(r.timers) == 0 {
+		return false, nil
+	}
+
+	sort.SliceStable(r.timers, func(i, j int) bool {
+		return r.timers[i].due < r.timers[j].due
+	})
+	timer := r.timers[0]
+	r.timers = r.timers[1:]
+	r.now = max(r.now, timer.due)
+
+	_, err := timer.fn(goja.Undefined(), timer.args...)
+	return true, err
+}
+
+func (r *gojaRuntime) installConsole() {
+	console := r.vm.NewObject()
+	for method, level := range consoleLevels {
+		level := level
+		console.Set(method, func(call goja.FunctionCall) goja.Value {
+			logger := r.logger
+			if logger == nil || !logger.Enabled(context.Background(), level) {
+				return goja.Undefined()
+			}
+			logger.Log(context.Background(), level, r.formatConsoleArgs(call.Arguments), "source", "console."+method)
+			return goja.Undefined()
+		})
+	}
+	r.vm.Set("console", console)
+}
+
+func (r *gojaRuntime) formatConsoleArgs(args []goja.Value) string {
+	parts := make([]string, 0, len(args))
+	for _, arg := range args {
+		obj, isObject := arg.(*goja.Object)
+		switch {
+		case !isObject:
+			parts = append(parts, arg.String())
+		case obj.ClassName() == "Error":
+			jsErr := gojaValueError(obj)
+			if jsErr.Stack != "" {
+				parts = append(parts, jsErr.Error()+"\n"+strings.TrimRight(jsErr.Stack, "\n"))
+			} else {
+				parts = append(parts, jsErr.Error())
+			}
+		default:
+			if json, err := r.jsonStringify(goja.Undefined(), obj); err == nil && !goja.IsUndefined(json) {
+				parts = append(parts, json.String())
+			} else {
+				parts = append(parts, arg.String())
+			}
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// gojaError converts errors returned by goja calls into *JSError, or into
+// ErrRenderTimeout / ctx.Err() when the call was interrupted by ctx.
+func gojaError(ctx context.Context, err error) error {
+	var interruptedErr *goja.InterruptedError
+	if errors.As(err, &interruptedErr) && ctx.Err() != nil {
+		return contextError(ctx)
+	}
+
+	var exception *goja.Exception
+	if errors.As(err, &exception) {
+		return gojaValueError(exception.Value())
+	}
+
+	var syntaxErr *goja.CompilerSyntaxError
+	if errors.As(err, &syntaxErr) {
+		return &JSError{Name: "SyntaxError", Message: strings.TrimPrefix(syntaxErr.Error(), "SyntaxError: ")}
+	}
+
+	return &JSError{Message: err.Error()}
+}
+
+// gojaValueError converts a thrown JS value into a *JSError.
+func gojaValueError(value goja.Value) *JSError {
+	obj, ok := value.(*goja.Object)
+	if !ok || obj.ClassName() != "Error" {
+		return &JSError{Message: "uncaught exception (thrown value is not an Error)"}
+	}
+
+	jsErr := &JSError{
+		Name:    gojaString(obj.Get("name")),
+		Message: gojaString(obj.Get("message")),
+	}
+
+	// goja stacks start with "Name: message" and carry a bytecode offset on each frame.
+	stack := gojaString(obj.Get("stack"))
+	if _, frames, ok := strings.Cut(stack, "\n"); ok {
+		stack = frames
+	} else {
+		stack = ""
+	}
+	jsErr.Stack = gojaProgramCounter.ReplaceAllString(stack, "$1")
+	return jsErr
+}
+
+func gojaString(value goja.Value) string {
+	if value == nil || goja.IsUndefined(value) || goja.IsNull(value) {
+		return ""
+	}
+	return value.String()
+}
@@ -0,0 +1,51 @@
+package core
+
+import (
+	"context"
+	"errors"
+)
+
+// Renderer renders pages from a server bundle. SSRPool is the standard implementation.
+type Renderer interface {
+	// Render executes globalThis.renderPage(props, context) and returns the HTML and head markup.
+	Render(ctx context.Context, request RenderRequest) (RenderResult, error)
+	// RenderStream executes globalThis.renderPageStream(props, write, context), passing chunks to write.
+	RenderStream(ctx context.Context, request RenderRequest, write func(chunk []byte) error) error
+	// Close releases the renderer's runtimes.
+	Close()
+}
+
+// JSRuntime is a single JavaScript engine instance with a server bundle evaluated.
+// A runtime is used by one goroutine at a time: the one that created it.
+//
+// When a render is interrupted because ctx is done, or because the heap limit is hit,
+// the runtime returns ErrRenderTimeout, ErrMemoryLimit or ctx.Err() and is discarded.
+type JSRuntime interface {
+	Render(ctx context.Context, request RenderRequest) (RenderResult, error)
+	RenderStream(ctx context.Context, request RenderRequest, write func(chunk []byte) error) error
+	Close()
+}
+
+// JSEngine creates runtimes for server bundles.
+type JSEngine interface {
+	// Name identifies the engine, e.g. "quickjs" or "goja".
+	Name() string
+	// Load validates bundle once, reporting syntax and evaluation errors as *JSError, and
+	// returns a constructor for runtimes with the bundle evaluated. The constructor is
+	// called on the goroutine that will use the runtime.
+	Load(name, bundle string, options SSRPoolOptions) (func() (JSRuntime, error), error)
+}
+
+// interrupted reports whether err means the runtime was interrupted and must not be reused.
+func interrupted(err error) bool {
+	return errors.Is(err, ErrRenderTimeout) ||
+		errors.Is(err, ErrMemoryLimit) ||
+		errors.Is(err, context.Canceled)
+}
+
+func contextError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrRenderTimeout
+	}
+	return ctx.Err()
+}
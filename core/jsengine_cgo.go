@@ -0,0 +1,9 @@
+//go:build cgo
+
+package core
+
+// DefaultJSEngine is used by pools that do not name an engine: QuickJS when cgo is available.
+var DefaultJSEngine JSEngine = QuickJS
+
+// JSEngines lists the engines compiled into this binary.
+var JSEngines = []JSEngine{QuickJS, Goja}
@@ -0,0 +1,9 @@
+//go:build !cgo
+
+package core
+
+// DefaultJSEngine is used by pools that do not name an engine: goja, since QuickJS needs cgo.
+var DefaultJSEngine JSEngine = Goja
+
+// JSEngines lists the engines compiled into this binary.
+var JSEngines = []JSEngine{Goja}
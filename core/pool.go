@@ -0,0 +1,273 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sync"
+)
+
+// DefaultSSRPoolSize is the number of runtimes kept per page when no size is configured.
+var DefaultSSRPoolSize = runtime.GOMAXPROCS(0)
+
+var (
+	// ErrPoolClosed is returned by Render when the pool was closed before a runtime picked up the job.
+	ErrPoolClosed = errors.New("ssr pool closed")
+	// ErrRenderTimeout is returned when a render is interrupted because its deadline passed.
+	ErrRenderTimeout = errors.New("render timeout")
+	// ErrMemoryLimit is returned when a render exceeds the runtime's heap limit.
+	ErrMemoryLimit = errors.New("memory limit exceeded")
+)
+
+var (
+	ssrPools   sync.Map
+	ssrPoolsMu sync.Mutex
+)
+
+// RenderRequest describes a single server render.
+type RenderRequest struct {
+	// Props is the JSON-encoded props object passed to the page component.
+	Props string
+	// Context is the JSON-encoded request context, such as the CSRF token, passed to the
+	// bundle after the props. Empty passes null.
+	Context string
+	// Logger receives console output from the bundle. Nil discards it.
+	Logger *slog.Logger
+}
+
+// requestContext returns the request's JSON-encoded context, or null when it has none.
+func requestContext(request RenderRequest) string {
+	if request.Context == "" {
+		return "null"
+	}
+	return request.Context
+}
+
+// RenderResult is the outcome of a renderPage call. Bundles return either the HTML
+// string or an object {html, head}.
+type RenderResult struct {
+	// HTML is the server-rendered page.
+	HTML string
+	// Head is the markup of the elements the page declared with Alloy's Head component.
+	Head string
+}
+
+type ssrJob struct {
+	ctx     context.Context
+	request RenderRequest
+	// write receives streamed chunks; nil for renderToString renders.
+	write  func(chunk []byte) error
+	result chan ssrResult
+}
+
+type ssrResult struct {
+	render RenderResult
+	err    error
+}
+
+// SSRPool keeps a bounded set of warmed JS runtimes for a single server bundle.
+// Each runtime lives on its own goroutine (QuickJS runtimes are bound to an OS thread)
+// with globalThis.renderPage already loaded.
+type SSRPool struct {
+	name       string
+	newRuntime func() (JSRuntime, error)
+	options    SSRPoolOptions
+
+	jobs      chan ssrJob
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu      sync.Mutex
+	workers int
+}
+
+// SSRPoolOptions configures the runtimes of an SSRPool.
+type SSRPoolOptions struct {
+	// Size bounds the number of runtimes. Defaults to DefaultSSRPoolSize.
+	Size int
+	// MemoryLimit caps each runtime's heap in bytes. Zero means unlimited.
+	// Engines without heap accounting (goja) ignore it.
+	MemoryLimit uint64
+	// Engine runs the bundle. Defaults to DefaultJSEngine.
+	Engine JSEngine
+}
+
+// GetSSRPool returns the runtime pool for the server bundle at cacheKey, creating it on first use.
+// Pools are kept per engine, size and memory limit, so pages sharing a bundle with
+// different limits each get runtimes with their own.
+func GetSSRPool(reader BundleReader, cacheKey string, options SSRPoolOptions) (*SSRPool, error) {
+	if options.Engine == nil {
+		options.Engine = DefaultJSEngine
+	}
+	if options.Size <= 0 {
+		options.Size = DefaultSSRPoolSize
+	}
+	poolKey := fmt.Sprintf("%s:%d:%d:%s", options.Engine.Name(), options.Size, options.MemoryLimit, cacheKey)
+
+	if val, ok := ssrPools.Load(poolKey); ok {
+		return val.(*SSRPool), nil
+	}
+
+	ssrPoolsMu.Lock()
+	defer ssrPoolsMu.Unlock()
+
+	if val, ok := ssrPools.Load(poolKey); ok {
+		return val.(*SSRPool), nil
+	}
+
+	bundle, err := GetServerBundle(reader, cacheKey)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := NewSSRPool(cacheKey, bundle, options)
+	if err != nil {
+		return nil, err
+	}
+
+	ssrPools.Store(poolKey, pool)
+	return pool, nil
+}
+
+// ClearSSRPools closes every runtime pool so the next render reloads its bundle.
+func ClearSSRPools() {
+	ssrPoolsMu.Lock()
+	defer ssrPoolsMu.Unlock()
+
+	ssrPools.Range(func(key, value interface{}) bool {
+		value.(*SSRPool).Close()
+		ssrPools.Delete(key)
+		return true
+	})
+}
+
+// NewSSRPool loads bundle into options.Engine once and returns a pool that lazily
+// starts up to options.Size runtimes evaluating it.
+func NewSSRPool(name string, bundle string, options SSRPoolOptions) (*SSRPool, error) {
+	if options.Size <= 0 {
+		options.Size = DefaultSSRPoolSize
+	}
+	if options.Engine == nil {
+		options.Engine = DefaultJSEngine
+	}
+
+	newRuntime, err := options.Engine.Load(name, bundle, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SSRPool{
+		name:       name,
+		newRuntime: newRuntime,
+		options:    options,
+		jobs:       make(chan ssrJob),
+		done:       make(chan struct{}),
+	}, nil
+}
+
+// Render executes renderPage(props) on an idle runtime, starting a new one if
+// the pool has not reached its size yet. Cancelling ctx, or reaching its deadline,
+// interrupts the render.
+func (p *SSRPool) Render(ctx context.Context, request RenderRequest) (RenderResult, error) {
+	result := p.submit(ssrJob{ctx: ctx, request: request})
+	return result.render, result.err
+}
+
+// RenderStream executes renderPageStream(props), passing each chunk produced by
+// React's stream to write as soon as it is available.
+func (p *SSRPool) RenderStream(ctx context.Context, request RenderRequest, write func(chunk []byte) error) error {
+	return p.submit(ssrJob{ctx: ctx, request: request, write: write}).err
+}
+
+func (p *SSRPool) submit(job ssrJob) ssrResult {
+	job.result = make(chan ssrResult, 1)
+
+	select {
+	case p.jobs <- job:
+	case <-p.done:
+		return ssrResult{err: ErrPoolClosed}
+	default:
+		p.grow()
+		select {
+		case p.jobs <- job:
+		case <-p.done:
+			return ssrResult{err: ErrPoolClosed}
+		case <-job.ctx.Done():
+			return ssrResult{err: contextError(job.ctx)}
+		}
+	}
+
+	return <-job.result
+}
+
+// Close stops all runtimes once they finish their current render.
+func (p *SSRPool) Close() {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+}
+
+func (p *SSRPool) grow() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.workers >= p.options.Size {
+		return
+	}
+	p.workers++
+	go p.worker()
+}
+
+func (p *SSRPool) worker() {
+	recycle := false
+	defer func() {
+		// Interrupted or out-of-memory runtimes are replaced rather than reused.
+		if recycle {
+			select {
+			case <-p.done:
+			default:
+				go p.worker()
+				return
+			}
+		}
+		p.mu.Lock()
+		p.workers--
+		p.mu.Unlock()
+	}()
+
+	rt, loadErr := p.newRuntime()
+	if loadErr == nil {
+		defer rt.Close()
+	}
+
+	for {
+		select {
+		case job := <-p.jobs:
+			if loadErr != nil {
+				job.result <- ssrResult{err: loadErr}
+				return
+			}
+			if err := job.ctx.Err(); err != nil {
+				job.result <- ssrResult{err: contextError(job.ctx)}
+				continue
+			}
+
+			var result ssrResult
+			if job.write != nil {
+				result.err = rt.RenderStream(job.ctx, job.request, job.write)
+			} else {
+				result.render, result.err = rt.Render(job.ctx, job.request)
+			}
+
+			recycle = interrupted(result.err)
+			job.result <- result
+			if recycle {
+				return
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
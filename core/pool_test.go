@@ -0,0 +1,202 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBundle = `globalThis.renderPage = function (props, context) {
+  if (props.throw) throw new TypeError("bad props");
+  if (props.loop) while (true) {}
+  if (props.grow) { var a = []; while (true) a.push(new Array(100000).fill(1)); }
+  if (props.nohtml) return { head: "<title>" + props.title + "</title>" };
+  if (props.head) return { html: "<h1>" + props.title + "</h1>", head: "<title>" + props.title + "</title>" };
+  if (context) return "<h1>" + props.title + " " + context.user + "</h1>";
+  return "<h1>" + props.title + "</h1>";
+}`
+
+// forEachEngine runs fn as a subtest against every engine compiled into the binary.
+func forEachEngine(t *testing.T, fn func(t *testing.T, engine JSEngine)) {
+	for _, engine := range JSEngines {
+		t.Run(engine.Name(), func(t *testing.T) {
+			fn(t, engine)
+		})
+	}
+}
+
+func TestSSRPoolRender(t *testing.T) {
+	forEachEngine(t, testSSRPoolRender)
+}
+
+func testSSRPoolRender(t *testing.T, engine JSEngine) {
+	pool, err := NewSSRPool("test.ssr.js", testBundle, SSRPoolOptions{Size: 1, Engine: engine})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	result, err := pool.Render(context.Background(), RenderRequest{Props: `{"title":"Hello"}`})
+	if err != nil || result.HTML != "<h1>Hello</h1>" {
+		t.Fatalf("got %q, %v", result.HTML, err)
+	}
+
+	result, err = pool.Render(context.Background(), RenderRequest{Props: `{"title":"Hello","head":true}`})
+	if err != nil || result.HTML != "<h1>Hello</h1>" || result.Head != "<title>Hello</title>" {
+		t.Fatalf("got %+v, %v", result, err)
+	}
+
+	result, err = pool.Render(context.Background(), RenderRequest{Props: `{"title":"Hello"}`, Context: `{"user":"ada"}`})
+	if err != nil || result.HTML != "<h1>Hello ada</h1>" {
+		t.Fatalf("got %q, %v", result.HTML, err)
+	}
+
+	_, err = pool.Render(context.Background(), RenderRequest{Props: `{"throw":true}`})
+	var jsErr *JSError
+	if !errors.As(err, &jsErr) || jsErr.Name != "TypeError" || jsErr.Message != "bad props" {
+		t.Fatalf("expected TypeError, got %#v", err)
+	}
+
+	_, err = pool.Render(context.Background(), RenderRequest{Props: `{"title":"Hello","nohtml":true}`})
+	if !errors.As(err, &jsErr) || jsErr.Name != "TypeError" {
+		t.Fatalf("expected TypeError for a result without html, got %#v", err)
+	}
+
+	pool.Close()
+	if _, err := pool.Render(context.Background(), RenderRequest{Props: `{}`}); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("expected ErrPoolClosed, got %v", err)
+	}
+}
+
+func TestSSRPoolLimits(t *testing.T) {
+	forEachEngine(t, testSSRPoolLimits)
+}
+
+func testSSRPoolLimits(t *testing.T, engine JSEngine) {
+	pool, err := NewSSRPool("test.ssr.js", testBundle, SSRPoolOptions{Size: 1, MemoryLimit: 32 << 20, Engine: engine})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Render(ctx, RenderRequest{Props: `{"loop":true}`}); !errors.Is(err, ErrRenderTimeout) {
+		t.Fatalf("expected ErrRenderTimeout, got %v", err)
+	}
+
+	// goja has no heap accounting.
+	if engine.Name() == "quickjs" {
+		if _, err := pool.Render(context.Background(), RenderRequest{Props: `{"grow":true}`}); !errors.Is(err, ErrMemoryLimit) {
+			t.Fatalf("expected ErrMemoryLimit, got %v", err)
+		}
+	}
+
+	// The interrupted runtimes are recycled and the pool keeps serving.
+	result, err := pool.Render(context.Background(), RenderRequest{Props: `{"title":"Still up"}`})
+	if err != nil || result.HTML != "<h1>Still up</h1>" {
+		t.Fatalf("got %q, %v", result.HTML, err)
+	}
+}
+
+func TestGetSSRPoolOptions(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("test.ssr.js", []byte(testBundle), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ClearSSRPools)
+	reader := &FileSystemBundleReader{Dev: true}
+
+	get := func(options SSRPoolOptions) *SSRPool {
+		t.Helper()
+		pool, err := GetSSRPool(reader, "test.ssr.js", options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pool
+	}
+
+	pool := get(SSRPoolOptions{Size: 1, MemoryLimit: 32 << 20})
+	if get(SSRPoolOptions{Size: 1, MemoryLimit: 32 << 20}) != pool {
+		t.Fatal("expected the pool to be reused for the same options")
+	}
+	// Pages sharing a bundle keep their own limits.
+	if other := get(SSRPoolOptions{Size: 1, MemoryLimit: 64 << 20}); other == pool || other.options.MemoryLimit != 64<<20 {
+		t.Fatalf("expected a pool with its own memory limit, got %+v", other.options)
+	}
+	if other := get(SSRPoolOptions{Size: 2, MemoryLimit: 32 << 20}); other == pool || other.options.Size != 2 {
+		t.Fatalf("expected a pool with its own size, got %+v", other.options)
+	}
+}
+
+func TestNewSSRPoolSyntaxError(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine JSEngine) {
+		_, err := NewSSRPool("test.ssr.js", `function (`, SSRPoolOptions{Engine: engine})
+		var jsErr *JSError
+		if !errors.As(err, &jsErr) || jsErr.Name != "SyntaxError" {
+			t.Fatalf("expected SyntaxError, got %#v", err)
+		}
+	})
+}
+
+func TestSSRPoolConsole(t *testing.T) {
+	forEachEngine(t, testSSRPoolConsole)
+}
+
+func testSSRPoolConsole(t *testing.T, engine JSEngine) {
+	bundle := `var console = globalThis.console || {log: function () {}};
+globalThis.renderPage = function (props) {
+  console.warn("rendering", props);
+  return "ok";
+}`
+	pool, err := NewSSRPool("test.ssr.js", bundle, SSRPoolOptions{Size: 1, Engine: engine})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	var out strings.Builder
+	logger := slog.New(slog.NewTextHandler(&out, nil)).With("route", "/")
+	if _, err := pool.Render(context.Background(), RenderRequest{Props: `{"id":1}`, Logger: logger}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := out.String()
+	for _, want := range []string{"level=WARN", `msg="rendering {\"id\":1}"`, "route=/", "source=console.warn"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %s in %q", want, got)
+		}
+	}
+}
+
+func TestSSRPoolRenderStream(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, engine JSEngine) {
+		bundle := `globalThis.renderPageStream = function (props, write) {
+  return new Promise(function (resolve) {
+    write(new Uint8Array([60, 112, 62]));
+    setTimeout(function () {
+      write(props.text + "</p>");
+      resolve();
+    }, 10);
+  });
+}`
+		pool, err := NewSSRPool("test.ssr.js", bundle, SSRPoolOptions{Size: 1, Engine: engine})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pool.Close()
+
+		var out strings.Builder
+		err = pool.RenderStream(context.Background(), RenderRequest{Props: `{"text":"hi"}`}, func(chunk []byte) error {
+			out.Write(chunk)
+			return nil
+		})
+		if err != nil || out.String() != "<p>hi</p>" {
+			t.Fatalf("got %q, %v", out.String(), err)
+		}
+	})
+}
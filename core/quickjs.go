@@ -0,0 +1,309 @@
+//go:build cgo
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/buke/quickjs-go"
+)
+
+// QuickJS runs bundles in QuickJS, loading them from precompiled bytecode.
+// It supports RenderMemoryLimit and requires cgo.
+var QuickJS JSEngine = quickJSEngine{}
+
+type quickJSEngine struct{}
+
+func (quickJSEngine) Name() string { return "quickjs" }
+
+func (quickJSEngine) Load(name, bundle string, options SSRPoolOptions) (func() (JSRuntime, error), error) {
+	bytecode, err := compileBundle(name, bundle)
+	if err != nil {
+		return nil, err
+	}
+	return func() (JSRuntime, error) {
+		return newQuickJSRuntime(bytecode, options)
+	}, nil
+}
+
+// compileBundle compiles the bundle to bytecode and checks that it evaluates cleanly.
+// Runs on a throwaway goroutine because quickjs.NewRuntime locks the calling OS thread.
+func compileBundle(name string, bundle string) ([]byte, error) {
+	type compileResult struct {
+		bytecode []byte
+		err      error
+	}
+
+	ch := make(chan compileResult, 1)
+	go func() {
+		rt := quickjs.NewRuntime()
+		defer rt.Close()
+		ctx := rt.NewContext()
+		defer ctx.Close()
+
+		// Compile does not surface syntax errors itself, so check a compile-only eval first.
+		checked := ctx.Eval(bundle, quickjs.EvalFileName(name), quickjs.EvalFlagCompileOnly(true))
+		if checked.IsException() {
+			checked.Free()
+			ch <- compileResult{err: jsException(ctx)}
+			return
+		}
+		checked.Free()
+
+		bytecode, err := ctx.Compile(bundle, quickjs.EvalFileName(name))
+		if err != nil {
+			ch <- compileResult{err: err}
+			return
+		}
+
+		res := ctx.EvalBytecode(bytecode)
+		defer res.Free()
+		if res.IsException() {
+			ch <- compileResult{err: jsException(ctx)}
+			return
+		}
+
+		ch <- compileResult{bytecode: bytecode}
+	}()
+
+	result := <-ch
+	return result.bytecode, result.err
+}
+
+type quickJSRuntime struct {
+	rt  *quickjs.Runtime
+	ctx *quickjs.Context
+
+	// renderCtx and logger belong to the render in progress, if any.
+	renderCtx context.Context
+	logger    *slog.Logger
+
+	stream  *chunkWriter
+	writeFn *quickjs.Value
+}
+
+func newQuickJSRuntime(bytecode []byte, options SSRPoolOptions) (*quickJSRuntime, error) {
+	r := &quickJSRuntime{rt: quickjs.NewRuntime(), stream: &chunkWriter{}}
+	r.ctx = r.rt.NewContext()
+
+	installConsole(r.ctx, func() *slog.Logger { return r.logger })
+
+	loaded := r.ctx.EvalBytecode(bytecode)
+	defer loaded.Free()
+	if loaded.IsException() {
+		err := jsException(r.ctx)
+		r.Close()
+		return nil, err
+	}
+
+	// Limits apply to renders only, so a bundle larger than the heap cap still loads.
+	if options.MemoryLimit > 0 {
+		r.rt.SetMemoryLimit(options.MemoryLimit)
+	}
+
+	r.rt.SetInterruptHandler(func() int {
+		if r.renderCtx != nil && r.renderCtx.Err() != nil {
+			return 1
+		}
+		return 0
+	})
+
+	// A single native write function per runtime; each function registered on a
+	// context stays alive until the context closes.
+	r.writeFn = r.ctx.NewFunction(r.stream.call)
+	return r, nil
+}
+
+func (r *quickJSRuntime) Render(ctx context.Context, request RenderRequest) (RenderResult, error) {
+	r.begin(ctx, request)
+	defer r.end()
+
+	result, err := renderInContext(r.ctx, request)
+	return result, classifyRenderError(ctx, err)
+}
+
+func (r *quickJSRuntime) RenderStream(ctx context.Context, request RenderRequest, write func(chunk []byte) error) error {
+	r.begin(ctx, request)
+	defer r.end()
+
+	r.stream.reset(write)
+	defer r.stream.reset(nil)
+
+	err := streamInContext(r.ctx, request, r.writeFn)
+	if err == nil {
+		err = r.stream.err
+	}
+	return classifyRenderError(ctx, err)
+}
+
+func (r *quickJSRuntime) begin(ctx context.Context, request RenderRequest) {
+	r.renderCtx = ctx
+	r.logger = request.Logger
+}
+
+func (r *quickJSRuntime) end() {
+	r.renderCtx = nil
+	r.logger = nil
+}
+
+func (r *quickJSRuntime) Close() {
+	if r.writeFn != nil {
+		r.writeFn.Free()
+	}
+	r.ctx.Close()
+	r.rt.Close()
+}
+
+// classifyRenderError maps interrupts and heap exhaustion to ErrRenderTimeout,
+// ErrMemoryLimit or the context's error.
+func classifyRenderError(ctx context.Context, err error) error {
+	var jsErr *JSError
+	if !errors.As(err, &jsErr) {
+		return err
+	}
+
+	if strings.Contains(jsErr.Message, "out of memory") {
+		return fmt.Errorf("%w: %s", ErrMemoryLimit, jsErr.Error())
+	}
+	if ctx.Err() != nil && strings.Contains(jsErr.Message, "interrupted") {
+		return contextError(ctx)
+	}
+	return err
+}
+
+// chunkWriter forwards Uint8Array chunks from JS to the current job's writer.
+type chunkWriter struct {
+	write func(chunk []byte) error
+	err   error
+}
+
+func (w *chunkWriter) reset(write func(chunk []byte) error) {
+	w.write = write
+	w.err = nil
+}
+
+func (w *chunkWriter) call(ctx *quickjs.Context, this *quickjs.Value, args []*quickjs.Value) *quickjs.Value {
+	if w.write == nil || w.err != nil || len(args) == 0 {
+		return ctx.NewUndefined()
+	}
+
+	chunk, err := args[0].ToUint8Array()
+	if err != nil {
+		chunk = []byte(args[0].String())
+	}
+	w.err = w.write(chunk)
+	return ctx.NewUndefined()
+}
+
+func renderInContext(ctx *quickjs.Context, request RenderRequest) (RenderResult, error) {
+	propsVal := ctx.ParseJSON(request.Props)
+	defer propsVal.Free()
+	contextVal := ctx.ParseJSON(requestContext(request))
+	defer contextVal.Free()
+
+	res := ctx.Globals().Call("renderPage", propsVal, contextVal)
+	defer res.Free()
+
+	if res.IsException() {
+		return RenderResult{}, jsException(ctx)
+	}
+	if !res.IsObject() {
+		return RenderResult{HTML: res.String()}, nil
+	}
+
+	html := res.Get("html")
+	defer html.Free()
+	head := res.Get("head")
+	defer head.Free()
+
+	if html.IsUndefined() || html.IsNull() {
+		return RenderResult{}, &JSError{Name: "TypeError", Message: "renderPage returned an object without html"}
+	}
+	result := RenderResult{HTML: html.String()}
+	if head.IsString() {
+		result.Head = head.String()
+	}
+	return result, nil
+}
+
+func streamInContext(ctx *quickjs.Context, request RenderRequest, writeFn *quickjs.Value) error {
+	propsVal := ctx.ParseJSON(request.Props)
+	defer propsVal.Free()
+	contextVal := ctx.ParseJSON(requestContext(request))
+	defer contextVal.Free()
+
+	// Await owns the promise and runs pending jobs and timers until it settles.
+	res := ctx.Await(ctx.Globals().Call("renderPageStream", propsVal, writeFn, contextVal))
+	defer res.Free()
+
+	if res.IsException() {
+		return jsException(ctx)
+	}
+	return nil
+}
+
+// jsException takes the pending exception from ctx and converts it into a *JSError.
+func jsException(ctx *quickjs.Context) error {
+	err := ctx.Exception()
+
+	var qjsErr *quickjs.Error
+	if errors.As(err, &qjsErr) {
+		return &JSError{
+			Name:    qjsErr.Name,
+			Message: qjsErr.Message,
+			Stack:   qjsErr.Stack,
+		}
+	}
+	if err != nil {
+		return &JSError{Message: err.Error()}
+	}
+	return &JSError{Message: "uncaught exception (thrown value is not an Error)"}
+}
+
+// installConsole defines a native globalThis.console whose methods forward to the
+// logger returned by current. Must run before the bundle is evaluated so its
+// console fallback picks up the native object.
+func installConsole(ctx *quickjs.Context, current func() *slog.Logger) {
+	console := ctx.NewObject()
+	for method, level := range consoleLevels {
+		level := level
+		console.Set(method, ctx.NewFunction(func(ctx *quickjs.Context, this *quickjs.Value, args []*quickjs.Value) *quickjs.Value {
+			logger := current()
+			if logger == nil || !logger.Enabled(context.Background(), level) {
+				return ctx.NewUndefined()
+			}
+			logger.Log(context.Background(), level, formatConsoleArgs(args), "source", "console."+method)
+			return ctx.NewUndefined()
+		}))
+	}
+	ctx.Globals().Set("console", console)
+}
+
+func formatConsoleArgs(args []*quickjs.Value) string {
+	parts := make([]string, 0, len(args))
+	for _, arg := range args {
+		switch {
+		case arg.IsString():
+			parts = append(parts, arg.String())
+		case arg.IsError():
+			if err, ok := arg.ToError().(*quickjs.Error); ok && err.Stack != "" {
+				parts = append(parts, err.Error()+"\n"+strings.TrimRight(err.Stack, "\n"))
+			} else {
+				parts = append(parts, arg.String())
+			}
+		case arg.IsObject():
+			if json := arg.JSONStringify(); json != "" {
+				parts = append(parts, json)
+			} else {
+				parts = append(parts, arg.String())
+			}
+		default:
+			parts = append(parts, arg.String())
+		}
+	}
+	return strings.Join(parts, " ")
+}
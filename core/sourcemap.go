@@ -0,0 +1,270 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var sourceMapCache sync.Map
+
+// stackFramePattern matches "file:line:col" locations inside QuickJS stack frames.
+var stackFramePattern = regexp.MustCompile(`([^\s()]+\.js):(\d+):(\d+)`)
+
+// SourceMap is a decoded source map (v3) able to resolve generated positions.
+type SourceMap struct {
+	Sources        []string
+	SourcesContent []string
+	lines          [][]mappingSegment
+}
+
+type mappingSegment struct {
+	genColumn  int
+	source     int
+	origLine   int
+	origColumn int
+}
+
+// SourcePosition is a resolved location in an original source file. Line and Column are 1-based.
+type SourcePosition struct {
+	Source string
+	Line   int
+	Column int
+}
+
+func (p SourcePosition) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.Source, p.Line, p.Column)
+}
+
+type rawSourceMap struct {
+	Version        int      `json:"version"`
+	SourceRoot     string   `json:"sourceRoot"`
+	Sources        []string `json:"sources"`
+	SourcesContent []string `json:"sourcesContent"`
+	Mappings       string   `json:"mappings"`
+}
+
+// ParseSourceMap decodes a source map. Sources are resolved relative to mapDir.
+func ParseSourceMap(data []byte, mapDir string) (*SourceMap, error) {
+	var raw rawSourceMap
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid source map: %w", err)
+	}
+	if raw.Version != 3 {
+		return nil, fmt.Errorf("unsupported source map version %d", raw.Version)
+	}
+
+	sources := make([]string, len(raw.Sources))
+	for i, source := range raw.Sources {
+		sources[i] = path.Clean(path.Join(mapDir, raw.SourceRoot, source))
+	}
+
+	lines, err := decodeMappings(raw.Mappings)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SourceMap{
+		Sources:        sources,
+		SourcesContent: raw.SourcesContent,
+		lines:          lines,
+	}, nil
+}
+
+// Resolve maps a 1-based generated line and column to its original position.
+func (m *SourceMap) Resolve(line, column int) (SourcePosition, bool) {
+	if line < 1 || line > len(m.lines) {
+		return SourcePosition{}, false
+	}
+
+	segments := m.lines[line-1]
+	col := column - 1
+	i := sort.Search(len(segments), func(i int) bool {
+		return segments[i].genColumn > col
+	})
+	if i == 0 {
+		return SourcePosition{}, false
+	}
+
+	seg := segments[i-1]
+	if seg.source < 0 || seg.source >= len(m.Sources) {
+		return SourcePosition{}, false
+	}
+
+	return SourcePosition{
+		Source: m.Sources[seg.source],
+		Line:   seg.origLine + 1,
+		Column: seg.origColumn + 1,
+	}, true
+}
+
+// CodeFrame renders the lines around pos with a caret under the column.
+func (m *SourceMap) CodeFrame(pos SourcePosition, context int) string {
+	content := ""
+	for i, source := range m.Sources {
+		if source == pos.Source && i < len(m.SourcesContent) {
+			content = m.SourcesContent[i]
+			break
+		}
+	}
+	if content == "" {
+		return ""
+	}
+
+	lines := strings.Split(content, "\n")
+	start := max(pos.Line-context, 1)
+	end := min(pos.Line+context, len(lines))
+	width := len(strconv.Itoa(end))
+
+	var sb strings.Builder
+	for n := start; n <= end; n++ {
+		marker := " "
+		if n == pos.Line {
+			marker = ">"
+		}
+		fmt.Fprintf(&sb, "%s %*d | %s\n", marker, width, n, strings.TrimRight(lines[n-1], "\r"))
+		if n == pos.Line {
+			fmt.Fprintf(&sb, "  %s | %s^\n", strings.Repeat(" ", width), strings.Repeat(" ", max(pos.Column-1, 0)))
+		}
+	}
+	return sb.String()
+}
+
+func decodeMappings(mappings string) ([][]mappingSegment, error) {
+	var lines [][]mappingSegment
+	var source, origLine, origColumn int
+
+	for _, line := range strings.Split(mappings, ";") {
+		var segments []mappingSegment
+		genColumn := 0
+
+		for _, field := range strings.Split(line, ",") {
+			if field == "" {
+				continue
+			}
+			values, err := decodeVLQ(field)
+			if err != nil {
+				return nil, err
+			}
+
+			genColumn += values[0]
+			if len(values) < 4 {
+				continue
+			}
+			source += values[1]
+			origLine += values[2]
+			origColumn += values[3]
+
+			segments = append(segments, mappingSegment{
+				genColumn:  genColumn,
+				source:     source,
+				origLine:   origLine,
+				origColumn: origColumn,
+			})
+		}
+
+		lines = append(lines, segments)
+	}
+
+	return lines, nil
+}
+
+const base64Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+func decodeVLQ(field string) ([]int, error) {
+	var values []int
+	value, shift := 0, 0
+
+	for i := 0; i < len(field); i++ {
+		digit := strings.IndexByte(base64Alphabet, field[i])
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid source map mapping %q", field)
+		}
+
+		value += (digit & 31) << shift
+		if digit&32 != 0 {
+			shift += 5
+			continue
+		}
+
+		if value&1 != 0 {
+			values = append(values, -(value >> 1))
+		} else {
+			values = append(values, value>>1)
+		}
+		value, shift = 0, 0
+	}
+
+	if shift != 0 || len(values) == 0 {
+		return nil, fmt.Errorf("invalid source map mapping %q", field)
+	}
+	return values, nil
+}
+
+// GetSourceMap loads and caches the source map that sits next to a bundle (bundle + ".map").
+func GetSourceMap(reader BundleReader, bundleKey string) (*SourceMap, error) {
+	mapKey := bundleKey + ".map"
+	if val, ok := sourceMapCache.Load(mapKey); ok {
+		return val.(*SourceMap), nil
+	}
+
+	data, err := reader.ReadBundle(mapKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceMap, err := ParseSourceMap(data, path.Dir(mapKey))
+	if err != nil {
+		return nil, err
+	}
+
+	sourceMapCache.Store(mapKey, sourceMap)
+	return sourceMap, nil
+}
+
+// ClearSourceMapCache drops parsed source maps so rebuilt bundles are re-read.
+func ClearSourceMapCache() {
+	sourceMapCache.Range(func(key, value interface{}) bool {
+		sourceMapCache.Delete(key)
+		return true
+	})
+}
+
+// ApplySourceMap rewrites the stack of jsErr through the bundle's source map, pointing
+// frames at the original files, and records the first original location with a code frame.
+// Errors without a source map (e.g. production bundles) are left untouched.
+func ApplySourceMap(reader BundleReader, bundleKey string, jsErr *JSError) {
+	if jsErr == nil || jsErr.Stack == "" {
+		return
+	}
+
+	sourceMap, err := GetSourceMap(reader, bundleKey)
+	if err != nil {
+		return
+	}
+
+	jsErr.Stack = stackFramePattern.ReplaceAllStringFunc(jsErr.Stack, func(frame string) string {
+		match := stackFramePattern.FindStringSubmatch(frame)
+		if path.Clean(match[1]) != path.Clean(bundleKey) {
+			return frame
+		}
+
+		line, _ := strconv.Atoi(match[2])
+		column, _ := strconv.Atoi(match[3])
+		pos, ok := sourceMap.Resolve(line, column)
+		if !ok {
+			return frame
+		}
+
+		if jsErr.Location == nil && !strings.Contains(pos.Source, "node_modules/") {
+			jsErr.Location = &pos
+			jsErr.CodeFrame = sourceMap.CodeFrame(pos, 2)
+		}
+		return pos.String()
+	})
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSourceMap = `{
+  "version": 3,
+  "sources": ["../../pages/index.tsx"],
+  "sourcesContent": ["interface Props { user?: { name: string } }\n\nexport default function Page(props: Props) {\n  const name: string = props.user!.name;\n  return \"<h1>\" + name + \"</h1>\";\n}\n"],
+  "mappings": ";;;AAEe,SAAR,KAAsB,OAAc;AACzC,QAAM,OAAe,MAAM,KAAM;AACjC,SAAO,SAAS,OAAO;AACzB",
+  "names": []
+}`
+
+func TestSourceMapResolve(t *testing.T) {
+	sm, err := ParseSourceMap([]byte(testSourceMap), ".alloy/pages")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pos, ok := sm.Resolve(5, 22)
+	if !ok {
+		t.Fatal("expected position to resolve")
+	}
+	if pos.String() != "pages/index.tsx:4:30" {
+		t.Errorf("got %s, want pages/index.tsx:4:30", pos)
+	}
+
+	if _, ok := sm.Resolve(1, 1); ok {
+		t.Error("expected unmapped line to not resolve")
+	}
+
+	frame := sm.CodeFrame(pos, 1)
+	if !strings.Contains(frame, "> 4 |   const name: string = props.user!.name;") {
+		t.Errorf("code frame missing highlighted line:\n%s", frame)
+	}
+}
+
+func TestDecodeVLQ(t *testing.T) {
+	values, err := decodeVLQ("AAgBC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{0, 0, 16, 1}
+	for i := range want {
+		if values[i] != want[i] {
+			t.Fatalf("got %v, want %v", values, want)
+		}
+	}
+
+	if _, err := decodeVLQ("g"); err == nil {
+		t.Error("expected error for truncated value")
+	}
+}
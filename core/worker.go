@@ -0,0 +1,280 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// SSRWorkerEnv marks a process started by SSRWorkerPool as a render worker.
+const SSRWorkerEnv = "Alloy_SSR_WORKER"
+
+// Worker processes talk to their parent over these inherited descriptors rather than
+// stdin/stdout, so stray prints from application code cannot corrupt the protocol.
+const (
+	workerInFD  = 3
+	workerOutFD = 4
+)
+
+// maxWorkerFrame bounds a single protocol frame; props and rendered pages are far smaller.
+const maxWorkerFrame = 256 << 20
+
+// IsSSRWorker reports whether this process was started as an SSR worker.
+func IsSSRWorker() bool {
+	return os.Getenv(SSRWorkerEnv) == "1"
+}
+
+// workerMessage is a frame of the worker protocol. Parents send "render", "cancel"
+// and "ping"; workers answer with "chunk", "log", "done" and "pong".
+type workerMessage struct {
+	ID   uint64 `json:"id,omitempty"`
+	Type string `json:"type"`
+
+	// render
+	Bundle      string        `json:"bundle,omitempty"`
+	Props       string        `json:"props,omitempty"`
+	Context     string        `json:"context,omitempty"`
+	Stream      bool          `json:"stream,omitempty"`
+	Timeout     time.Duration `json:"timeout,omitempty"`
+	Engine      string        `json:"engine,omitempty"`
+	PoolSize    int           `json:"poolSize,omitempty"`
+	MemoryLimit uint64        `json:"memoryLimit,omitempty"`
+
+	// chunk and done
+	Data  []byte       `json:"data,omitempty"`
+	Head  string       `json:"head,omitempty"`
+	Error *workerError `json:"error,omitempty"`
+
+	// log
+	Level   slog.Level `json:"level,omitempty"`
+	Message string     `json:"message,omitempty"`
+	Source  string     `json:"source,omitempty"`
+}
+
+// workerError carries a render error across the process boundary.
+type workerError struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
+	Stack   string `json:"stack,omitempty"`
+}
+
+func encodeWorkerError(err error) *workerError {
+	if err == nil {
+		return nil
+	}
+
+	var jsErr *JSError
+	switch {
+	case errors.Is(err, ErrRenderTimeout):
+		return &workerError{Kind: "timeout", Message: err.Error()}
+	case errors.Is(err, ErrMemoryLimit):
+		return &workerError{Kind: "memory", Message: err.Error()}
+	case errors.Is(err, context.Canceled):
+		return &workerError{Kind: "canceled", Message: err.Error()}
+	case errors.As(err, &jsErr):
+		return &workerError{Kind: "js", Name: jsErr.Name, Message: jsErr.Message, Stack: jsErr.Stack}
+	default:
+		return &workerError{Kind: "error", Message: err.Error()}
+	}
+}
+
+func (e *workerError) decode() error {
+	if e == nil {
+		return nil
+	}
+
+	switch e.Kind {
+	case "timeout":
+		return ErrRenderTimeout
+	case "memory":
+		return fmt.Errorf("%w: %s", ErrMemoryLimit, e.Message)
+	case "canceled":
+		return context.Canceled
+	case "js":
+		return &JSError{Name: e.Name, Message: e.Message, Stack: e.Stack}
+	default:
+		return errors.New(e.Message)
+	}
+}
+
+func writeWorkerMessage(w io.Writer, msg workerMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	_, err = w.Write(frame)
+	return err
+}
+
+func readWorkerMessage(r io.Reader) (workerMessage, error) {
+	var msg workerMessage
+
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return msg, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxWorkerFrame {
+		return msg, fmt.Errorf("worker frame of %d bytes exceeds limit", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return msg, err
+	}
+	err := json.Unmarshal(data, &msg)
+	return msg, err
+}
+
+// ServeSSRWorker runs the worker side of SSRWorkerPool: it renders the bundles it is
+// asked for with in-process SSR pools until the parent closes the pipe.
+func ServeSSRWorker(reader BundleReader) error {
+	in := os.NewFile(workerInFD, "alloy-ssr-in")
+	out := os.NewFile(workerOutFD, "alloy-ssr-out")
+	if in == nil || out == nil {
+		return errors.New("ssr worker pipes are missing")
+	}
+	defer out.Close()
+
+	return serveSSRWorker(reader, bufio.NewReader(in), out)
+}
+
+func serveSSRWorker(reader BundleReader, in io.Reader, out io.Writer) error {
+	defer ClearSSRPools()
+
+	var writeMu sync.Mutex
+	send := func(msg workerMessage) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return writeWorkerMessage(out, msg)
+	}
+
+	var (
+		mu      sync.Mutex
+		cancels = map[uint64]context.CancelFunc{}
+		renders sync.WaitGroup
+	)
+	defer renders.Wait()
+
+	for {
+		msg, err := readWorkerMessage(in)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch msg.Type {
+		case "ping":
+			if err := send(workerMessage{Type: "pong"}); err != nil {
+				return err
+			}
+		case "cancel":
+			mu.Lock()
+			if cancel, ok := cancels[msg.ID]; ok {
+				cancel()
+			}
+			mu.Unlock()
+		case "render":
+			var ctx context.Context
+			var cancel context.CancelFunc
+			if msg.Timeout > 0 {
+				ctx, cancel = context.WithTimeout(context.Background(), msg.Timeout)
+			} else {
+				ctx, cancel = context.WithCancel(context.Background())
+			}
+			mu.Lock()
+			cancels[msg.ID] = cancel
+			mu.Unlock()
+
+			renders.Add(1)
+			go func(msg workerMessage) {
+				defer renders.Done()
+				defer func() {
+					mu.Lock()
+					delete(cancels, msg.ID)
+					mu.Unlock()
+					cancel()
+				}()
+
+				result, err := workerRender(ctx, reader, msg, send)
+				send(workerMessage{ID: msg.ID, Type: "done", Data: []byte(result.HTML), Head: result.Head, Error: encodeWorkerError(err)})
+			}(msg)
+		}
+	}
+}
+
+func workerRender(ctx context.Context, reader BundleReader, msg workerMessage, send func(workerMessage) error) (RenderResult, error) {
+	engine := DefaultJSEngine
+	if msg.Engine != "" {
+		engine = nil
+		for _, candidate := range JSEngines {
+			if candidate.Name() == msg.Engine {
+				engine = candidate
+			}
+		}
+		if engine == nil {
+			return RenderResult{}, fmt.Errorf("JS engine %q is not available in the worker", msg.Engine)
+		}
+	}
+
+	pool, err := GetSSRPool(reader, msg.Bundle, SSRPoolOptions{
+		Size:        msg.PoolSize,
+		MemoryLimit: msg.MemoryLimit,
+		Engine:      engine,
+	})
+	if err != nil {
+		return RenderResult{}, err
+	}
+
+	request := RenderRequest{
+		Props:   msg.Props,
+		Context: msg.Context,
+		Logger:  slog.New(&workerLogHandler{id: msg.ID, send: send}),
+	}
+
+	if !msg.Stream {
+		return pool.Render(ctx, request)
+	}
+	return RenderResult{}, pool.RenderStream(ctx, request, func(chunk []byte) error {
+		return send(workerMessage{ID: msg.ID, Type: "chunk", Data: chunk})
+	})
+}
+
+// workerLogHandler forwards console records to the parent, which logs them with the
+// request's own logger.
+type workerLogHandler struct {
+	id   uint64
+	send func(workerMessage) error
+}
+
+func (h *workerLogHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *workerLogHandler) Handle(_ context.Context, r slog.Record) error {
+	msg := workerMessage{ID: h.id, Type: "log", Level: r.Level, Message: r.Message}
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "source" {
+			msg.Source = a.Value.String()
+		}
+		return true
+	})
+	return h.send(msg)
+}
+
+func (h *workerLogHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *workerLogHandler) WithGroup(string) slog.Handler { return h }
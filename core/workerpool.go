@@ -0,0 +1,418 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrWorkerCrashed is returned for renders that were in flight when their worker process died.
+	ErrWorkerCrashed = errors.New("ssr worker crashed")
+	// ErrWorkersClosed is returned by renders started after SSRWorkerPool.Close.
+	ErrWorkersClosed = errors.New("ssr worker pool closed")
+)
+
+// DefaultSSRWorkerHealthInterval is how often idle and busy workers are pinged.
+const DefaultSSRWorkerHealthInterval = 5 * time.Second
+
+// SSRWorkerOptions configures an SSRWorkerPool.
+type SSRWorkerOptions struct {
+	// Workers is the number of child processes.
+	Workers int
+	// MaxRenders recycles a worker after it served this many renders. Zero never recycles.
+	MaxRenders int
+	// HealthInterval is how often workers are pinged; a worker that does not answer
+	// within the interval is killed and replaced. Defaults to DefaultSSRWorkerHealthInterval.
+	HealthInterval time.Duration
+	// Command builds the command for a new worker. Defaults to re-executing the
+	// current binary with its arguments. SSRWorkerEnv is added to its environment.
+	Command func() (*exec.Cmd, error)
+}
+
+// SSRWorkerPool renders in child processes so a crash or leak in the JS engine cannot take
+// down the server. Each worker is the same binary re-executed with SSRWorkerEnv set, in
+// which case the application hands control to ServeSSRWorker (alloy.New does this).
+// Workers start on first use and are restarted after crashing or being recycled.
+type SSRWorkerPool struct {
+	options SSRWorkerOptions
+
+	mu     sync.Mutex
+	slots  []*ssrWorker
+	next   int
+	closed bool
+}
+
+type ssrWorker struct {
+	pool *SSRWorkerPool
+	cmd  *exec.Cmd
+	in   io.WriteCloser
+
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	calls    map[uint64]*workerCall
+	lastID   uint64
+	renders  int
+	active   int
+	draining bool
+
+	pong chan struct{}
+	dead chan struct{}
+}
+
+type workerCall struct {
+	logger *slog.Logger
+	result chan ssrResult
+
+	// mu guards write so no chunk is delivered after the caller stopped waiting.
+	mu    sync.Mutex
+	write func(chunk []byte) error
+}
+
+// NewSSRWorkerPool returns a pool of options.Workers render processes.
+func NewSSRWorkerPool(options SSRWorkerOptions) *SSRWorkerPool {
+	if options.Workers <= 0 {
+		options.Workers = 1
+	}
+	if options.HealthInterval <= 0 {
+		options.HealthInterval = DefaultSSRWorkerHealthInterval
+	}
+	if options.Command == nil {
+		options.Command = selfCommand
+	}
+
+	return &SSRWorkerPool{
+		options: options,
+		slots:   make([]*ssrWorker, options.Workers),
+	}
+}
+
+func selfCommand() (*exec.Cmd, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	return exec.Command(executable, os.Args[1:]...), nil
+}
+
+// Renderer returns a Renderer for the server bundle at bundleKey. options is applied
+// to the worker's in-process pool for that bundle.
+func (p *SSRWorkerPool) Renderer(bundleKey string, options SSRPoolOptions) Renderer {
+	return &workerRenderer{pool: p, bundle: bundleKey, options: options}
+}
+
+// Close stops accepting renders and lets every worker exit once its renders finish.
+func (p *SSRWorkerPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for i, worker := range p.slots {
+		if worker != nil {
+			worker.drain()
+			p.slots[i] = nil
+		}
+	}
+}
+
+// acquire picks the next live worker round-robin, starting one for empty slots, and
+// reserves a render on it.
+func (p *SSRWorkerPool) acquire() (*ssrWorker, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, ErrWorkersClosed
+	}
+
+	slot := p.next
+	p.next = (p.next + 1) % len(p.slots)
+
+	worker := p.slots[slot]
+	if worker == nil || worker.isDead() {
+		var err error
+		worker, err = p.start()
+		if err != nil {
+			return nil, err
+		}
+		p.slots[slot] = worker
+	}
+
+	worker.mu.Lock()
+	worker.renders++
+	worker.active++
+	recycle := p.options.MaxRenders > 0 && worker.renders >= p.options.MaxRenders
+	worker.mu.Unlock()
+
+	if recycle {
+		// This render is the worker's last; the slot gets a fresh process next time.
+		p.slots[slot] = nil
+		worker.mu.Lock()
+		worker.draining = true
+		worker.mu.Unlock()
+	}
+	return worker, nil
+}
+
+func (p *SSRWorkerPool) start() (*ssrWorker, error) {
+	cmd, err := p.options.Command()
+	if err != nil {
+		return nil, err
+	}
+
+	// Parent writes to childIn and reads from childOut; the child sees them as fds 3 and 4.
+	childIn, parentIn, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	parentOut, childOut, err := os.Pipe()
+	if err != nil {
+		childIn.Close()
+		parentIn.Close()
+		return nil, err
+	}
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, SSRWorkerEnv+"=1")
+	cmd.ExtraFiles = []*os.File{childIn, childOut}
+	if cmd.Stdout == nil {
+		cmd.Stdout = os.Stdout
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+
+	err = cmd.Start()
+	childIn.Close()
+	childOut.Close()
+	if err != nil {
+		parentIn.Close()
+		parentOut.Close()
+		return nil, fmt.Errorf("start ssr worker: %w", err)
+	}
+
+	worker := &ssrWorker{
+		pool:  p,
+		cmd:   cmd,
+		in:    parentIn,
+		calls: map[uint64]*workerCall{},
+		pong:  make(chan struct{}, 1),
+		dead:  make(chan struct{}),
+	}
+	go worker.read(bufio.NewReader(parentOut))
+	go worker.checkHealth()
+	return worker, nil
+}
+
+func (w *ssrWorker) render(ctx context.Context, bundle string, options SSRPoolOptions, request RenderRequest, write func(chunk []byte) error) ssrResult {
+	call := &workerCall{logger: request.Logger, write: write, result: make(chan ssrResult, 1)}
+
+	w.mu.Lock()
+	w.lastID++
+	id := w.lastID
+	w.calls[id] = call
+	w.mu.Unlock()
+
+	msg := workerMessage{
+		ID:          id,
+		Type:        "render",
+		Bundle:      bundle,
+		Props:       request.Props,
+		Context:     request.Context,
+		Stream:      write != nil,
+		PoolSize:    options.Size,
+		MemoryLimit: options.MemoryLimit,
+	}
+	if options.Engine != nil {
+		msg.Engine = options.Engine.Name()
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		msg.Timeout = max(time.Until(deadline), time.Millisecond)
+	}
+
+	if err := w.send(msg); err != nil {
+		w.finish(id)
+		return ssrResult{err: fmt.Errorf("%w: %v", ErrWorkerCrashed, err)}
+	}
+
+	select {
+	case result := <-call.result:
+		return result
+	case <-ctx.Done():
+		call.mu.Lock()
+		call.write = nil
+		call.mu.Unlock()
+
+		w.send(workerMessage{ID: id, Type: "cancel"})
+		w.finish(id)
+		return ssrResult{err: contextError(ctx)}
+	}
+}
+
+func (w *ssrWorker) send(msg workerMessage) error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	return writeWorkerMessage(w.in, msg)
+}
+
+// finish releases a render reserved by acquire and lets a draining worker exit once it is idle.
+func (w *ssrWorker) finish(id uint64) {
+	w.mu.Lock()
+	if _, ok := w.calls[id]; ok {
+		delete(w.calls, id)
+		w.active--
+	}
+	idle := w.draining && w.active == 0
+	w.mu.Unlock()
+
+	if idle {
+		w.in.Close()
+	}
+}
+
+// drain stops the worker once its in-flight renders finish.
+func (w *ssrWorker) drain() {
+	w.mu.Lock()
+	w.draining = true
+	idle := w.active == 0
+	w.mu.Unlock()
+
+	if idle {
+		w.in.Close()
+	}
+}
+
+func (w *ssrWorker) isDead() bool {
+	select {
+	case <-w.dead:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *ssrWorker) read(out io.Reader) {
+	for {
+		msg, err := readWorkerMessage(out)
+		if err != nil {
+			break
+		}
+
+		switch msg.Type {
+		case "pong":
+			select {
+			case w.pong <- struct{}{}:
+			default:
+			}
+		case "log":
+			if call := w.call(msg.ID); call != nil && call.logger != nil {
+				call.logger.Log(context.Background(), msg.Level, msg.Message, "source", msg.Source)
+			}
+		case "chunk":
+			if call := w.call(msg.ID); call != nil {
+				call.mu.Lock()
+				if call.write != nil {
+					if err := call.write(msg.Data); err != nil {
+						// The response is gone; stop forwarding and let the worker abandon the render.
+						call.write = nil
+						w.send(workerMessage{ID: msg.ID, Type: "cancel"})
+					}
+				}
+				call.mu.Unlock()
+			}
+		case "done":
+			if call := w.call(msg.ID); call != nil {
+				call.result <- ssrResult{render: RenderResult{HTML: string(msg.Data), Head: msg.Head}, err: msg.Error.decode()}
+				w.finish(msg.ID)
+			}
+		}
+	}
+
+	err := w.cmd.Wait()
+	w.in.Close()
+
+	w.mu.Lock()
+	draining := w.draining
+	calls := w.calls
+	w.calls = map[uint64]*workerCall{}
+	w.mu.Unlock()
+
+	if !draining || len(calls) > 0 {
+		fmt.Fprintf(os.Stderr, "❌ SSR worker %d exited: %v\n", w.cmd.Process.Pid, err)
+	}
+	for _, call := range calls {
+		call.result <- ssrResult{err: ErrWorkerCrashed}
+	}
+	close(w.dead)
+}
+
+func (w *ssrWorker) call(id uint64) *workerCall {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.calls[id]
+}
+
+// checkHealth pings the worker and kills it when a ping goes unanswered.
+func (w *ssrWorker) checkHealth() {
+	interval := w.pool.options.HealthInterval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.dead:
+			return
+		case <-ticker.C:
+		}
+
+		if err := w.send(workerMessage{Type: "ping"}); err != nil {
+			continue
+		}
+		select {
+		case <-w.pong:
+		case <-w.dead:
+			return
+		case <-time.After(interval):
+			fmt.Fprintf(os.Stderr, "❌ SSR worker %d is unresponsive, restarting\n", w.cmd.Process.Pid)
+			w.cmd.Process.Kill()
+			return
+		}
+	}
+}
+
+// workerRenderer renders one server bundle through an SSRWorkerPool.
+type workerRenderer struct {
+	pool    *SSRWorkerPool
+	bundle  string
+	options SSRPoolOptions
+}
+
+func (r *workerRenderer) Render(ctx context.Context, request RenderRequest) (RenderResult, error) {
+	worker, err := r.pool.acquire()
+	if err != nil {
+		return RenderResult{}, err
+	}
+	result := worker.render(ctx, r.bundle, r.options, request, nil)
+	return result.render, result.err
+}
+
+func (r *workerRenderer) RenderStream(ctx context.Context, request RenderRequest, write func(chunk []byte) error) error {
+	worker, err := r.pool.acquire()
+	if err != nil {
+		return err
+	}
+	return worker.render(ctx, r.bundle, r.options, request, write).err
+}
+
+// Close is a no-op; the worker pool outlives the renderers it hands out.
+func (r *workerRenderer) Close() {}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// SSRWorkerPool re-executes the test binary; act as the worker in that case.
+	if IsSSRWorker() {
+		if err := ServeSSRWorker(&FileSystemBundleReader{Dev: true}); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func writeTestBundle(t *testing.T, bundle string) string {
+	t.Helper()
+	bundlePath := filepath.Join(t.TempDir(), "test.ssr.js")
+	if err := os.WriteFile(bundlePath, []byte(bundle), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return bundlePath
+}
+
+func TestSSRWorkerPoolRender(t *testing.T) {
+	pool := NewSSRWorkerPool(SSRWorkerOptions{Workers: 1, MaxRenders: 2})
+	defer pool.Close()
+	renderer := pool.Renderer(writeTestBundle(t, testBundle), SSRPoolOptions{Size: 1})
+
+	var pids []int
+	for i := 0; i < 3; i++ {
+		result, err := renderer.Render(context.Background(), RenderRequest{Props: `{"title":"Hello"}`})
+		if err != nil || result.HTML != "<h1>Hello</h1>" {
+			t.Fatalf("got %q, %v", result.HTML, err)
+		}
+		pids = append(pids, pool.slotPID(0))
+	}
+	// The worker is recycled after two renders.
+	if pids[0] == 0 || pids[2] == 0 || pids[0] == pids[2] {
+		t.Fatalf("expected a fresh worker after recycling, got pids %v", pids)
+	}
+
+	result, err := renderer.Render(context.Background(), RenderRequest{Props: `{"title":"Hello","head":true}`})
+	if err != nil || result.Head != "<title>Hello</title>" {
+		t.Fatalf("got %+v, %v", result, err)
+	}
+
+	_, err = renderer.Render(context.Background(), RenderRequest{Props: `{"throw":true}`})
+	var jsErr *JSError
+	if !errors.As(err, &jsErr) || jsErr.Name != "TypeError" || jsErr.Message != "bad props" {
+		t.Fatalf("expected TypeError, got %#v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := renderer.Render(ctx, RenderRequest{Props: `{"loop":true}`}); !errors.Is(err, ErrRenderTimeout) {
+		t.Fatalf("expected ErrRenderTimeout, got %v", err)
+	}
+}
+
+func TestSSRWorkerPoolCrash(t *testing.T) {
+	pool := NewSSRWorkerPool(SSRWorkerOptions{Workers: 1})
+	defer pool.Close()
+	renderer := pool.Renderer(writeTestBundle(t, testBundle), SSRPoolOptions{Size: 1})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := renderer.Render(context.Background(), RenderRequest{Props: `{"loop":true}`})
+		done <- err
+	}()
+
+	// Kill the worker mid-render, as a segfault in the engine would.
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.slotPID(0) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	pool.mu.Lock()
+	pool.slots[0].cmd.Process.Kill()
+	pool.mu.Unlock()
+
+	if err := <-done; !errors.Is(err, ErrWorkerCrashed) {
+		t.Fatalf("expected ErrWorkerCrashed, got %v", err)
+	}
+
+	result, err := renderer.Render(context.Background(), RenderRequest{Props: `{"title":"Back"}`})
+	if err != nil || result.HTML != "<h1>Back</h1>" {
+		t.Fatalf("got %q, %v", result.HTML, err)
+	}
+}
+
+// slotPID returns the process ID of the worker in slot i, or 0 when the slot is empty.
+func (p *SSRWorkerPool) slotPID(i int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.slots[i] == nil {
+		return 0
+	}
+	return p.slots[i].cmd.Process.Pid
+}
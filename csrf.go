@@ -0,0 +1,174 @@
+package alloy
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// csrfTokenKey is the gin context key of the request's CSRF token.
+const csrfTokenKey = "alloy.csrfToken"
+
+// CSRFOptions protects page actions and API handlers against cross-site requests with
+// double-submit cookies: every visitor gets a random token in a cookie, and requests with
+// unsafe methods must send it back, which other sites cannot. API handlers take it in
+// the header; page actions also in the form field of a form submission.
+//
+// Pages carry the token for forms rendered with the runtime's CSRFInput, and the client
+// runtime adds it to any form posted with JavaScript enabled. Cached, coalesced and
+// prerendered documents are shared between visitors, so they never embed a token.
+type CSRFOptions struct {
+	// CookieName is the cookie holding the token. Defaults to "alloy_csrf".
+	CookieName string
+	// HeaderName is the request header carrying the token. Defaults to "X-CSRF-Token".
+	HeaderName string
+	// FieldName is the form field carrying the token. Defaults to "_csrf".
+	FieldName string
+	// Secure only sends the cookie over HTTPS.
+	Secure bool
+	// Exempt lists routes that are not checked, e.g. "/api/webhook" for a handler that
+	// authenticates its callers itself.
+	Exempt []string
+	// FailureHandler responds to rejected requests. Defaults to a 403 JSON response.
+	FailureHandler gin.HandlerFunc
+}
+
+// csrfConfig is the client runtime's CSRF configuration.
+type csrfConfig struct {
+	Cookie string `json:"cookie"`
+	Header string `json:"header"`
+	Field  string `json:"field"`
+}
+
+// withDefaults returns a copy of o with its defaults filled in, or nil when o is nil.
+func (o *CSRFOptions) withDefaults() *CSRFOptions {
+	if o == nil {
+		return nil
+	}
+	options := *o
+	if options.CookieName == "" {
+		options.CookieName = "alloy_csrf"
+	}
+	if options.HeaderName == "" {
+		options.HeaderName = "X-CSRF-Token"
+	}
+	if options.FieldName == "" {
+		options.FieldName = "_csrf"
+	}
+	return &options
+}
+
+// CSRFToken returns the request's CSRF token, for handlers rendering their own forms.
+// It is empty when CSRF protection is off.
+func CSRFToken(c *gin.Context) string {
+	return c.GetString(csrfTokenKey)
+}
+
+// csrf returns the middleware protecting route: it issues the token cookie and rejects
+// requests with unsafe methods whose token is missing or does not match it. The token
+// is read from form submissions' field only when forms is set, so API handlers' bodies
+// are left for them to read.
+func (o *CSRFOptions) csrf(route string, forms bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cookie, _ := c.Cookie(o.CookieName)
+		token := cookie
+		if token == "" {
+			token = newCSRFToken()
+			http.SetCookie(c.Writer, &http.Cookie{
+				Name:     o.CookieName,
+				Value:    token,
+				Path:     "/",
+				Secure:   o.Secure,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		c.Set(csrfTokenKey, token)
+
+		if safeMethod(c.Request.Method) || slices.Contains(o.Exempt, route) {
+			c.Next()
+			return
+		}
+
+		submitted := c.GetHeader(o.HeaderName)
+		if submitted == "" && forms && formSubmission(c) {
+			submitted = c.PostForm(o.FieldName)
+		}
+		if cookie == "" || subtle.ConstantTimeCompare([]byte(submitted), []byte(cookie)) != 1 {
+			if o.FailureHandler != nil {
+				o.FailureHandler(c)
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "CSRF token missing or invalid",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// handlers prepends the CSRF middleware for route to handlers when protection is on.
+// forms accepts the token in the field of form submissions, for page actions.
+func (o *CSRFOptions) handlers(route string, forms bool, handlers ...gin.HandlerFunc) []gin.HandlerFunc {
+	if o == nil {
+		return handlers
+	}
+	return append([]gin.HandlerFunc{o.csrf(route, forms)}, handlers...)
+}
+
+// formSubmission reports whether the request's body is a form, as browsers post them.
+func formSubmission(c *gin.Context) bool {
+	switch c.ContentType() {
+	case binding.MIMEPOSTForm, binding.MIMEMultipartPOSTForm:
+		return true
+	}
+	return false
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func newCSRFToken() string {
+	token := make([]byte, 32)
+	rand.Read(token)
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+// csrfScript returns the client runtime's CSRF configuration as JSON, or nothing when
+// protection is off.
+func (p *Page) csrfScript() template.JS {
+	if p.csrf == nil {
+		return ""
+	}
+	config, _ := json.Marshal(csrfConfig{
+		Cookie: p.csrf.CookieName,
+		Header: p.csrf.HeaderName,
+		Field:  p.csrf.FieldName,
+	})
+	return template.JS(config)
+}
+
+// ssrContext returns the JSON request context passed to the server bundle: the
+// CSRF token and the field forms send it in, when protection is on.
+func (p *Page) ssrContext(c *gin.Context) string {
+	if p.csrf == nil {
+		return ""
+	}
+	context, _ := json.Marshal(gin.H{
+		"csrf": gin.H{"token": CSRFToken(c), "field": p.csrf.FieldName},
+	})
+	return string(context)
+}
@@ -0,0 +1,147 @@
+package alloy
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dataPrefix is where the client router fetches the payload of the page it navigates to.
+const dataPrefix = "/_alloy/data"
+
+// pageData is the payload of a page's data endpoint.
+type pageData struct {
+	// Props are the loader's props, as the page is rendered with.
+	Props any `json:"props"`
+	// Module and CSS are the URLs of the page's client bundles.
+	Module string `json:"module"`
+	CSS    string `json:"css"`
+	Title  string `json:"title,omitempty"`
+}
+
+// DataPath returns the URL path of the data endpoint for the page at urlPath, e.g.
+// "/_alloy/data/blog/hello.json" for "/blog/hello" and "/_alloy/data/index.json" for "/".
+func DataPath(urlPath string) string {
+	if urlPath == "/" {
+		return dataPrefix + "/index.json"
+	}
+	return dataPrefix + strings.TrimSuffix(urlPath, "/") + ".json"
+}
+
+// dataRoute returns the router pattern of the data endpoint for route. A trailing
+// :param or *param keeps the .json suffix in its value; Data strips it.
+func dataRoute(route string) string {
+	if dynamicSegment(lastSegment(route)) {
+		return dataPrefix + route
+	}
+	return DataPath(route)
+}
+
+// Data serves the page's payload for client-side navigation: the props its loaders
+// return, its title and the URLs of its client bundles, as JSON. Loader results and
+// failures respond as they do for the document; the client router reloads the page
+// on anything but 200, and always for pages in islands mode. Prefetch requests with
+// X-Alloy-Prefetch: assets only get the bundle URLs, without running loaders.
+func (p *Page) Data(c *gin.Context) {
+	if p.islands {
+		// Islands pages are not rendered by the client; the router loads them in full.
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Page is rendered in islands mode",
+			"page":  p.Route,
+		})
+		return
+	}
+	if c.GetHeader(prefetchHeader) == "assets" {
+		p.assets(c)
+		return
+	}
+
+	if param := lastSegment(p.Route); dynamicSegment(param) {
+		name := param[1:]
+		value, ok := strings.CutSuffix(c.Param(name), ".json")
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": http.StatusText(http.StatusNotFound),
+				"page":  p.Route,
+			})
+			return
+		}
+		for i := range c.Params {
+			if c.Params[i].Key == name {
+				c.Params[i].Value = value
+			}
+		}
+	}
+	p.data(c)
+}
+
+func (p *Page) data(c *gin.Context) {
+	props, ok := p.loadProps(c)
+	if !ok {
+		return
+	}
+
+	module, css, ok := p.bundleURLs(c)
+	if !ok {
+		return
+	}
+
+	title := p.Title
+	if meta := requestMetadata(c); meta.Title != "" {
+		title = meta.Title
+	}
+
+	// A LoaderResult may have set another status; it is kept so the client reloads.
+	c.JSON(c.Writer.Status(), pageData{
+		Props:  props,
+		Module: module,
+		CSS:    css,
+		Title:  title,
+	})
+}
+
+// assets serves the page's payload without props, for prefetching its bundles.
+func (p *Page) assets(c *gin.Context) {
+	module, css, ok := p.bundleURLs(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, pageData{Module: module, CSS: css})
+}
+
+// bundleURLs returns the URLs of the page's client bundles. It responds with the
+// failure and reports false when they are missing.
+func (p *Page) bundleURLs(c *gin.Context) (string, string, bool) {
+	clientBundle, clientCSS, err := p.getClientJsFromFs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Client bundle files not found",
+			"page":  p.Route,
+			"file":  p.File,
+		})
+		return "", "", false
+	}
+	return p.assetURL(clientBundle), p.assetURL(clientCSS), true
+}
+
+// clientRoutes returns the routes of pages as JSON, for the client router to only
+// navigate to them and leave links to API handlers or static files to the browser.
+func clientRoutes(pages []Page) template.JS {
+	routes := make([]string, len(pages))
+	for i, page := range pages {
+		routes[i] = page.Route
+	}
+	encoded, _ := json.Marshal(routes)
+	return template.JS(encoded)
+}
+
+func lastSegment(route string) string {
+	return route[strings.LastIndex(route, "/")+1:]
+}
+
+func dynamicSegment(segment string) bool {
+	return strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*")
+}
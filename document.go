@@ -0,0 +1,318 @@
+package alloy
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/bertilxi/alloy/core"
+)
+
+// DocumentData is what the document shell is executed with.
+type DocumentData struct {
+	// RenderedContent is the server-rendered page.
+	RenderedContent template.HTML
+	// InitialProps are the page's props as JSON, for hydration.
+	InitialProps template.JS
+	// JS and CSS are the URLs of the page's client bundles.
+	JS  template.JS
+	CSS template.CSS
+	// Chunks are the URLs of the shared chunks JS imports, preloaded along with it.
+	Chunks []template.JS
+	// AppCSS is the URL of the stylesheet shared by every page through _app.tsx, if any.
+	AppCSS        template.CSS
+	Title         template.HTML
+	IsDev         bool
+	Hydrate       bool
+	RouteID       string
+	MetaTags      []MetaTag
+	Links         []Link
+	Lang          template.HTML
+	Class         template.HTML
+	WebSocketPort string
+	// JSONLD are the JSON-LD blocks loaders set with Metadata.
+	JSONLD []template.JS
+	// Head is the markup of the elements the page's components declared with Head.
+	Head template.HTML
+	// Prefetch is the client router's prefetch configuration as JSON.
+	Prefetch template.JS
+	// Routes are the routes the client router navigates to as JSON, empty when unknown.
+	Routes template.JS
+	// CSRF is the client runtime's CSRF configuration as JSON, empty when protection is off.
+	CSRF template.JS
+	// CSRFToken is the request's CSRF token. Shared documents have none.
+	CSRFToken string
+	// Islands loads the entries of the client islands on the page instead of its bundle.
+	Islands bool
+}
+
+// documentSlots define the parts of the document a custom shell places with
+// {{template "alloy.head" .}}, "alloy.content", "alloy.scripts" and "alloy.devReload".
+// alloy.content holds the #page container the client bundle hydrates. The title and
+// Head elements close alloy.head, so a streamed render can send the rest before them.
+const documentSlots = `{{define "alloy.head"}}
+    <meta charset="UTF-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1.0" />
+	<link rel="icon" href="/.alloy/favicon.svg" type="image/svg+xml" />
+	{{if .AppCSS}}<link rel="stylesheet" href="{{.AppCSS}}" />{{end}}
+	{{if .Hydrate}}<link rel="modulepreload" href="{{.JS}}" />{{range .Chunks}}
+	<link rel="modulepreload" href="{{.}}" />{{end}}{{end}}
+	<link rel="stylesheet" href="{{.CSS}}" data-alloy-css />
+	{{range .MetaTags}}
+		<meta name="{{.Name}}" content="{{.Content}}" property="{{.Property}}" />
+	{{end}}
+	{{range .Links}}
+		<link rel="{{.Rel}}" href="{{.Href}}" />
+	{{end}}
+	{{range .JSONLD}}
+		<script type="application/ld+json">{{.}}</script>
+	{{end}}
+	{{if .CSRFToken}}<meta name="csrf-token" content="{{.CSRFToken}}" />{{end}}
+	{{template "alloy.title" .}}
+{{end}}
+
+{{define "alloy.title"}}
+    {{if .Title}}<title>{{.Title}}</title>{{end}}
+	{{.Head}}
+{{end}}
+
+{{define "alloy.content"}}<div id="page">{{.RenderedContent}}</div>{{end}}
+
+{{define "alloy.scripts"}}
+	{{if .Hydrate}}
+	<script type="module" src="{{.JS}}"></script>
+	<script>window.PAGE_PROPS = {{.InitialProps}}; window.ALLOY_PREFETCH = {{.Prefetch}};{{if .Routes}} window.ALLOY_ROUTES = {{.Routes}};{{end}}{{if .CSRF}} window.ALLOY_CSRF = {{.CSRF}};{{end}}</script>
+	{{end}}
+	{{if .Islands}}
+	{{if .CSRF}}
+	<script>
+      window.ALLOY_CSRF = {{.CSRF}};
+      // Islands pages load no client router, which sets the token of posted forms.
+      document.addEventListener("submit", (event) => {
+        const form = event.target;
+        const config = window.ALLOY_CSRF;
+        if (form.method !== "post" || new URL(form.action, location.href).origin !== location.origin) {
+          return;
+        }
+        const cookie = document.cookie.split("; ").find((entry) => entry.startsWith(config.cookie + "="));
+        const token = cookie ? decodeURIComponent(cookie.slice(config.cookie.length + 1)) : document.querySelector('meta[name="csrf-token"]')?.content ?? "";
+        let input = form.querySelector('input[name="' + CSS.escape(config.field) + '"]');
+        if (!input) {
+          input = document.createElement("input");
+          input.type = "hidden";
+          input.name = config.field;
+          form.appendChild(input);
+        }
+        input.value = token;
+      }, true);
+	</script>
+	{{end}}
+	<script type="module">for (const island of document.querySelectorAll("alloy-island")) if (!island.parentElement.closest("alloy-island")) import(island.dataset.src);</script>
+	{{end}}
+{{end}}
+
+{{define "alloy.devReload"}}
+	{{if .IsDev}}
+	<script>
+      let reconnectAttempts = 0;
+      let reconnectDelay = 500;
+      const maxReconnectDelay = 5000;
+
+      function debounce(func, timeout = 500) {
+        let timer;
+        return (...args) => {
+          clearTimeout(timer);
+          timer = setTimeout(() => {
+            func.apply(this, args);
+          }, timeout);
+        };
+      }
+
+      const reload = debounce(() => {
+        console.log("reloading...");
+        window.location.reload(true);
+      });
+
+      let isFirstConnection = true;
+
+      function start() {
+        const wsPort = "{{.WebSocketPort}}" || window.location.port || "8080";
+        const wsUrl = "ws://" + window.location.hostname + ":" + wsPort + "/ws";
+        let socket = new WebSocket(wsUrl);
+
+        socket.onopen = () => {
+          // If reconnecting after a disconnect, reload the page
+          if (reconnectAttempts > 0) {
+            console.log("reconnected, reloading...");
+            reload();
+          }
+          reconnectAttempts = 0;
+          reconnectDelay = 500;
+          isFirstConnection = false;
+        };
+
+        socket.onmessage = reload;
+
+        socket.onerror = () => {
+          socket.close();
+        };
+
+        socket.onclose = () => {
+          socket = null;
+          reconnectAttempts++;
+          const delay = Math.min(reconnectDelay * Math.pow(1.5, reconnectAttempts), maxReconnectDelay);
+          setTimeout(start, delay);
+        };
+      }
+
+      start();
+	</script>
+	{{end}}
+{{end}}`
+
+// htmlTemplate is the default document shell.
+const htmlTemplate = `<!DOCTYPE html>
+<html lang="{{.Lang}}" class="{{.Class}}">
+<head>{{template "alloy.head" .}}</head>
+<body>
+    {{template "alloy.content" .}}
+	{{template "alloy.scripts" .}}
+	{{template "alloy.devReload" .}}
+</body>
+</html>`
+
+var (
+	slotsTemplate   = template.Must(template.New("alloy.slots").Parse(documentSlots))
+	defaultTemplate = template.Must(parseDocument(nil))
+)
+
+// parseDocument combines a document shell with the slot definitions. A nil shell
+// parses the default one.
+func parseDocument(shell *template.Template) (*template.Template, error) {
+	tmpl := template.Must(slotsTemplate.Clone())
+	if shell == nil {
+		return tmpl.New("document").Parse(htmlTemplate)
+	}
+
+	for _, t := range shell.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		if _, err := tmpl.AddParseTree(t.Name(), t.Tree.Copy()); err != nil {
+			return nil, err
+		}
+	}
+	return tmpl.Lookup(shell.Name()), nil
+}
+
+// documentSlot matches the placeholders a rendered _document.tsx holds for each slot.
+var documentSlot = regexp.MustCompile(`<alloy-slot name="(\w+)"></alloy-slot>`)
+
+// A rendered _document.tsx is parsed with delimiters its markup cannot hold, so braces
+// in it, e.g. in inline JSON, scripts or styles, stay text. Only the slots and the
+// lang and className placeholders become actions.
+const (
+	documentLeftDelim  = "\x00{"
+	documentRightDelim = "}\x00"
+)
+
+var documentActions = strings.NewReplacer(
+	"{{.Lang}}", documentLeftDelim+".Lang"+documentRightDelim,
+	"{{.Class}}", documentLeftDelim+".Class"+documentRightDelim,
+)
+
+// document is the shell pages are rendered into: Options.Document, a _document.tsx
+// rendered on first use, or the default shell.
+type document struct {
+	template *template.Template
+	// file is the _document.tsx to render, empty when Options.Document is set.
+	file string
+	// shell renders file with the engine's options.
+	shell *Page
+
+	mu         sync.Mutex
+	resolved   bool
+	generation uint64
+	rendered   *template.Template
+}
+
+func newDocument(shell *template.Template, pagesDir string) *document {
+	if shell == nil {
+		return &document{
+			template: defaultTemplate,
+			file:     filepath.Join(pagesDir, core.DocumentFile),
+		}
+	}
+
+	tmpl, err := parseDocument(shell)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Invalid document template, using the default: %v\n", err)
+		tmpl = defaultTemplate
+	}
+	return &document{template: tmpl}
+}
+
+// assignOptions sets the options a _document.tsx is rendered with.
+func (d *document) assignOptions(options Options) {
+	if d.file == "" {
+		return
+	}
+	d.shell = &Page{File: d.file}
+	d.shell.AssignOptions(options)
+}
+
+// get returns the shell to render p into. A _document.tsx is rendered once per
+// generation of the bundle cache, so edits show up once ClearBundleCache runs.
+func (d *document) get(ctx context.Context, p *Page) (*template.Template, error) {
+	if d.file == "" {
+		return d.template, nil
+	}
+
+	generation := core.BundleGeneration()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.resolved && d.generation == generation {
+		return d.rendered, nil
+	}
+
+	shell := *d.shell
+	// Bundles are read where the page reads them, which only differs from the engine's
+	// source while the build prerenders pages.
+	shell.embedFS = p.embedFS
+	if _, err := shell.getServerJsFromFs(); err != nil {
+		// The app has no _document.tsx.
+		d.resolved, d.generation, d.rendered = true, generation, d.template
+		return d.template, nil
+	}
+
+	result, err := shell.ssr(ctx, core.RenderRequest{Props: "{}"})
+	if err != nil {
+		return nil, fmt.Errorf("render %s: %w", d.file, err)
+	}
+
+	text := documentActions.Replace(result.HTML)
+	text = documentSlot.ReplaceAllString(text, documentLeftDelim+`template "alloy.$1" .`+documentRightDelim)
+	if !strings.HasPrefix(strings.ToLower(text), "<!doctype") {
+		text = "<!DOCTYPE html>" + text
+	}
+	tmpl, err := template.Must(slotsTemplate.Clone()).New("document").Delims(documentLeftDelim, documentRightDelim).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", d.file, err)
+	}
+
+	d.resolved, d.generation, d.rendered = true, generation, tmpl
+	return tmpl, nil
+}
+
+// documentTemplate returns the shell the page is rendered into.
+func (p *Page) documentTemplate(ctx context.Context) (*template.Template, error) {
+	if p.document == nil {
+		return defaultTemplate, nil
+	}
+	return p.document.get(ctx, p)
+}
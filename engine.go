@@ -5,10 +5,12 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/bertilxi/alloy/core"
+	"golang.org/x/sync/singleflight"
 )
 
 // RegisterRoutes registers all pages and handlers to the Gin router.
@@ -20,17 +22,23 @@ func (engine *Engine) RegisterRoutes() error {
 	}
 
 	engine.Pages = pages
+	engine.registerErrorPages()
 
 	// Register API handlers first (so they take precedence over page routes)
 	if engine.Handlers != nil && len(engine.Handlers) > 0 {
 		for route, handler := range engine.Handlers {
-			engine.Router.Any(route, handler)
+			engine.Router.Any(route, engine.CSRF.handlers(route, false, handler)...)
 		}
 	}
 
 	for i := range engine.Pages {
 		engine.Pages[i].AssignOptions(engine.Options)
-		engine.Router.GET(engine.Pages[i].Route, engine.Pages[i].Render)
+		route := engine.Pages[i].Route
+		engine.Router.GET(route, engine.CSRF.handlers(route, false, engine.Pages[i].handler())...)
+		engine.Router.GET(dataRoute(route), engine.Pages[i].Data)
+		if engine.Pages[i].Action != nil {
+			engine.Router.POST(route, engine.CSRF.handlers(route, true, engine.Pages[i].Act)...)
+		}
 	}
 
 	return nil
@@ -69,9 +77,66 @@ func (engine *Engine) Start() error {
 	return engine.Listen()
 }
 
+// Page returns the registered page for route, or nil. Use it after RegisterRoutes
+// to configure individual pages, e.g. engine.Page("/").Coalesce = &alloy.CoalesceOptions{}.
+func (engine *Engine) Page(route string) *Page {
+	for i := range engine.Pages {
+		if engine.Pages[i].Route == route {
+			return &engine.Pages[i]
+		}
+	}
+	return nil
+}
+
+// RenderStats reports render queue depth and wait times. It is the zero value
+// when MaxConcurrentRenders is not set.
+func (engine *Engine) RenderStats() core.AdmissionStats {
+	if engine.admission == nil {
+		return core.AdmissionStats{}
+	}
+	return engine.admission.Stats()
+}
+
 // AssignOptions assigns global options to a page.
 func (page *Page) AssignOptions(options Options) {
 	page.embedFS = options.EmbedFS
+	page.ssrPoolSize = options.SSRPoolSize
+	page.logger = options.Logger
+	page.jsEngine = options.JSEngine
+	page.ssrWorkers = options.ssrWorkers
+	page.admission = options.admission
+	page.saturatedHandler = options.SaturatedHandler
+	page.pageStore = options.PageStore
+	page.document = options.document
+	page.errorPage = options.errorPage
+	page.notFoundPage = options.notFoundPage
+	page.prefetch = options.Prefetch
+	page.prefetchData = options.PrefetchData
+	page.csrf = options.CSRF
+	page.Prerender = page.Prerender || slices.Contains(options.Prerender, page.Route)
+	page.Layouts = slices.Clone(page.Layouts)
+	for i := range page.Layouts {
+		if page.Layouts[i].Loader == nil {
+			page.Layouts[i].Loader = options.LayoutLoaders[page.Layouts[i].Route]
+		}
+	}
+	if page.Paths == nil {
+		page.Paths = options.Paths[page.Route]
+	}
+	if page.Action == nil {
+		page.Action = options.Actions[page.Route]
+	}
+	if page.flights == nil {
+		page.flights = &singleflight.Group{}
+	}
+	page.Streaming = page.Streaming || options.Streaming
+	page.islands = options.Islands
+	if page.RenderTimeout == 0 {
+		page.RenderTimeout = options.RenderTimeout
+	}
+	if page.RenderMemoryLimit == 0 {
+		page.RenderMemoryLimit = options.RenderMemoryLimit
+	}
 	page.ErrorHandler = options.ErrorHandler
 	page.Class = options.Class
 	page.Links = append(page.Links, options.Links...)
@@ -96,6 +161,16 @@ func (page *Page) assetURL(path string) string {
 }
 
 func New(options Options) *Engine {
+	if core.IsSSRWorker() {
+		// This process is an SSR worker started by the server; it only renders.
+		reader := &core.FileSystemBundleReader{Dev: core.IsDev(), EmbedFS: options.EmbedFS}
+		if err := core.ServeSSRWorker(reader); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ SSR worker failed: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	if core.IsProd() {
 		gin.SetMode(gin.ReleaseMode)
 	}
@@ -114,6 +189,33 @@ func New(options Options) *Engine {
 		pagesDir = "./pages"
 	}
 
+	logger := options.Logger
+	if logger == nil {
+		logger = core.NewConsoleLogger(core.IsDev(), options.LogLevel)
+	}
+
+	var ssrWorkers *core.SSRWorkerPool
+	if options.SSRWorkers > 0 && !core.IsDev() {
+		ssrWorkers = core.NewSSRWorkerPool(core.SSRWorkerOptions{
+			Workers:    options.SSRWorkers,
+			MaxRenders: options.SSRWorkerMaxRenders,
+		})
+	}
+
+	var admission *core.Admission
+	if options.MaxConcurrentRenders > 0 {
+		admission = core.NewAdmission(core.AdmissionOptions{
+			MaxConcurrent: options.MaxConcurrentRenders,
+			MaxQueue:      options.RenderQueueSize,
+			QueueTimeout:  options.RenderQueueTimeout,
+		})
+	}
+
+	pageStore := options.PageStore
+	if pageStore == nil {
+		pageStore = core.NewMemoryPageStore(core.DefaultPageStoreSize)
+	}
+
 	engine := &Engine{
 		Options: Options{
 			Router:       options.Router,
@@ -127,11 +229,41 @@ func New(options Options) *Engine {
 			PagesDir:     pagesDir,
 			Loaders:      options.Loaders,
 			Handlers:     options.Handlers,
+			Paths:        options.Paths,
 			ErrorHandler: options.ErrorHandler,
+			SSRPoolSize:  options.SSRPoolSize,
+			Streaming:    options.Streaming,
+
+			RenderTimeout:     options.RenderTimeout,
+			RenderMemoryLimit: options.RenderMemoryLimit,
+			Logger:            logger,
+			LogLevel:          options.LogLevel,
+			JSEngine:          options.JSEngine,
+
+			SSRWorkers:          options.SSRWorkers,
+			SSRWorkerMaxRenders: options.SSRWorkerMaxRenders,
+			ssrWorkers:          ssrWorkers,
+
+			MaxConcurrentRenders: options.MaxConcurrentRenders,
+			RenderQueueSize:      options.RenderQueueSize,
+			RenderQueueTimeout:   options.RenderQueueTimeout,
+			SaturatedHandler:     options.SaturatedHandler,
+			PageStore:            pageStore,
+			LayoutLoaders:        options.LayoutLoaders,
+			Prerender:            options.Prerender,
+			Document:             options.Document,
+			Prefetch:             options.Prefetch,
+			PrefetchData:         options.PrefetchData,
+			Actions:              options.Actions,
+			CSRF:                 options.CSRF.withDefaults(),
+			Islands:              options.Islands,
+			document:             newDocument(options.Document, pagesDir),
+			admission:            admission,
 		},
 		Loaders:  options.Loaders,
 		Handlers: options.Handlers,
 	}
+	engine.document.assignOptions(engine.Options)
 
 	return engine
 }
@@ -0,0 +1,127 @@
+package alloy
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bertilxi/alloy/core"
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorPageProps are the props pages/_error.tsx is rendered with.
+type ErrorPageProps struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	// Error details the failure. It is only set in development.
+	Error *ErrorDetails `json:"error,omitempty"`
+	// Data is the result of the error page's loader, if it has one.
+	Data any `json:"data,omitempty"`
+}
+
+// ErrorDetails describes a failed render to the error page in development.
+type ErrorDetails struct {
+	Step      string `json:"step"`
+	Message   string `json:"message"`
+	Details   string `json:"details,omitempty"`
+	Exception string `json:"exception,omitempty"`
+	Stack     string `json:"stack,omitempty"`
+	Location  string `json:"location,omitempty"`
+	CodeFrame string `json:"codeFrame,omitempty"`
+}
+
+// renderFailed responds with status to a failed render: through the project's _error.tsx
+// when it has one, otherwise with body as JSON.
+func (p *Page) renderFailed(c *gin.Context, status int, renderErr *core.RenderError, body any) {
+	if p.errorPage != nil && !c.Writer.Written() {
+		p.errorPage.renderError(c, status, renderErr)
+		return
+	}
+	c.JSON(status, body)
+}
+
+// renderError renders the error page for a request that failed with status.
+func (errorPage *Page) renderError(c *gin.Context, status int, renderErr *core.RenderError) {
+	props := ErrorPageProps{Status: status, Message: http.StatusText(status)}
+	if renderErr != nil && core.IsDev() {
+		props.Error = errorDetails(renderErr)
+	}
+
+	// A failure of the error page itself is reported as JSON.
+	page := *errorPage
+	page.Props = props
+	page.Streaming = false
+	page.ErrorHandler = nil
+	page.errorPage = nil
+	if loader := errorPage.Loader; loader != nil {
+		page.Loader = func(c *gin.Context) (any, error) {
+			data, err := loader(c)
+			if err != nil {
+				return nil, err
+			}
+			props.Data = data
+			return props, nil
+		}
+	}
+
+	c.Status(status)
+	page.render(c)
+}
+
+func errorDetails(renderErr *core.RenderError) *ErrorDetails {
+	details := &ErrorDetails{
+		Step:    renderErr.Step,
+		Message: renderErr.Message,
+		Details: renderErr.Details,
+	}
+	var jsErr *core.JSError
+	if errors.As(renderErr, &jsErr) {
+		details.Exception = jsErr.Error()
+		details.Stack = jsErr.Stack
+		if jsErr.Location != nil {
+			details.Location = jsErr.Location.String()
+			details.CodeFrame = jsErr.CodeFrame
+		}
+	}
+	return details
+}
+
+// registerErrorPages sets up pages/_error.tsx as the default error renderer and
+// pages/404.tsx, or the error page, as the response for unknown routes and NotFound.
+func (engine *Engine) registerErrorPages() {
+	errorPage := DiscoverErrorPage(engine.PagesDir, engine.Loaders)
+	if errorPage != nil {
+		if _, err := errorPage.getServerJsFromFs(); err == nil {
+			errorPage.AssignOptions(engine.Options)
+			engine.errorPage = errorPage
+		}
+	}
+
+	notFoundPage := DiscoverNotFoundPage(engine.PagesDir, engine.Loaders)
+	if notFoundPage != nil {
+		if _, err := notFoundPage.getServerJsFromFs(); err == nil {
+			notFoundPage.AssignOptions(engine.Options)
+			engine.notFoundPage = notFoundPage
+		}
+	}
+
+	if engine.notFoundPage != nil || engine.errorPage != nil {
+		// A page with the engine's options answers for routes that have none.
+		var fallback Page
+		fallback.AssignOptions(engine.Options)
+		engine.Router.NoRoute(fallback.notFound)
+	}
+}
+
+// notFound responds with 404: through pages/404.tsx when the project has one, then
+// pages/_error.tsx, otherwise JSON.
+func (p *Page) notFound(c *gin.Context) {
+	if p.notFoundPage != nil && p.Route != core.NotFoundRoute {
+		c.Status(http.StatusNotFound)
+		p.notFoundPage.render(c)
+		return
+	}
+	p.renderFailed(c, http.StatusNotFound, nil, gin.H{
+		"error": http.StatusText(http.StatusNotFound),
+		"page":  p.Route,
+	})
+}
@@ -9,14 +9,19 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/bertilxi/alloy/core"
 )
 
 // LoaderInfo represents a discovered loader function
 type LoaderInfo struct {
-	Route        string // e.g., "/", "/about", "/blog/:slug"
-	FunctionName string // e.g., "LoadIndex", "LoadAbout"
-	FilePath     string // relative path to .go file, e.g., "pages/index.go"
-	IsAPI        bool   // true if this is an API handler (in pages/api/), false if page loader
+	Route          string // e.g., "/", "/about", "/blog/:slug"
+	FunctionName   string // e.g., "LoadIndex", "LoadAbout"; empty if the page only declares paths or an action
+	FilePath       string // relative path to .go file, e.g., "pages/index.go"
+	IsAPI          bool   // true if this is an API handler (in pages/api/), false if page loader
+	PathsFunction  string // e.g., "BlogSlugPaths"; lists route params for static export, empty if none
+	IsLayout       bool   // true if this is a _layout.go loader; Route is then its directory's route, e.g. "/blog"
+	ActionFunction string // e.g., "ContactAction"; handles form POSTs to the page route, empty if none
 }
 
 // DiscoverLoaders finds all .go files with valid loader and API handler functions in pagesDir
@@ -65,7 +70,10 @@ func DiscoverLoaders(pagesDir string) ([]LoaderInfo, error) {
 			return nil
 		}
 
-		// Look for the first exported function matching loader or API handler signature
+		// Look for the first exported function matching loader or API handler signature,
+		// and for a page's paths function
+		relPath, _ := filepath.Rel(absPageDir, path)
+		var page *LoaderInfo
 		for _, decl := range node.Decls {
 			funcDecl, ok := decl.(*ast.FuncDecl)
 			if !ok {
@@ -80,32 +88,49 @@ func DiscoverLoaders(pagesDir string) ([]LoaderInfo, error) {
 			if isAPIFile {
 				// Check if it matches the API handler signature: func(c *gin.Context)
 				if IsValidAPIHandlerSignature(funcDecl) {
-					route := FilePathToRoute(path, absPageDir, true)
-					relPath, _ := filepath.Rel(absPageDir, path)
-
 					loaders = append(loaders, LoaderInfo{
-						Route:        route,
+						Route:        FilePathToRoute(path, absPageDir, true),
 						FunctionName: funcDecl.Name.Name,
 						FilePath:     relPath,
 						IsAPI:        true,
 					})
 					break
 				}
-			} else {
-				// Check if it matches the loader signature: func(c *gin.Context) (any, error)
-				if IsValidLoaderSignature(funcDecl) {
-					route := FilePathToRoute(path, absPageDir, false)
-					relPath, _ := filepath.Rel(absPageDir, path)
+				continue
+			}
 
-					loaders = append(loaders, LoaderInfo{
-						Route:        route,
-						FunctionName: funcDecl.Name.Name,
-						FilePath:     relPath,
-						IsAPI:        false,
-					})
-					break
+			if page == nil {
+				page = &LoaderInfo{
+					Route:    FilePathToRoute(path, absPageDir, false),
+					FilePath: relPath,
+					IsLayout: filepath.Base(path) == "_layout.go",
+				}
+				if page.IsLayout {
+					page.Route = core.LayoutRoute(page.Route)
 				}
 			}
+
+			// Check if it is an action: a function named ...Action with the loader signature
+			if IsActionName(funcDecl.Name.Name) {
+				if !page.IsLayout && page.ActionFunction == "" && IsValidLoaderSignature(funcDecl) {
+					page.ActionFunction = funcDecl.Name.Name
+				}
+				continue
+			}
+
+			// Check if it matches the loader signature: func(c *gin.Context) (any, error)
+			if page.FunctionName == "" && IsValidLoaderSignature(funcDecl) {
+				page.FunctionName = funcDecl.Name.Name
+			}
+
+			// Check if it matches the paths signature: func() ([]map[string]string, error)
+			if !page.IsLayout && page.PathsFunction == "" && IsValidPathsSignature(funcDecl) {
+				page.PathsFunction = funcDecl.Name.Name
+			}
+		}
+
+		if page != nil && (page.FunctionName != "" || page.PathsFunction != "" || page.ActionFunction != "") {
+			loaders = append(loaders, *page)
 		}
 
 		return nil
@@ -153,6 +178,42 @@ func IsValidLoaderSignature(funcDecl *ast.FuncDecl) bool {
 	return true
 }
 
+// IsActionName checks if a page function is an action by its name: "Action" or a name
+// ending in it, e.g. "ContactAction". Actions have the loader signature, so only their
+// name tells them apart from the loader; a loader such as "ActionsLoader" stays one.
+func IsActionName(name string) bool {
+	return strings.HasSuffix(name, "Action")
+}
+
+// IsValidPathsSignature checks if a function has the paths signature used by
+// dynamic routes for static export:
+// func() ([]map[string]string, error)
+func IsValidPathsSignature(funcDecl *ast.FuncDecl) bool {
+	if funcDecl.Type.Params != nil && len(funcDecl.Type.Params.List) > 0 {
+		return false
+	}
+	if funcDecl.Type.Results == nil || len(funcDecl.Type.Results.List) != 2 {
+		return false
+	}
+
+	// First return should be []map[string]string
+	array, ok := funcDecl.Type.Results.List[0].Type.(*ast.ArrayType)
+	if !ok || array.Len != nil {
+		return false
+	}
+	mapType, ok := array.Elt.(*ast.MapType)
+	if !ok || !isIdent(mapType.Key, "string") || !isIdent(mapType.Value, "string") {
+		return false
+	}
+
+	return IsErrorType(funcDecl.Type.Results.List[1].Type)
+}
+
+func isIdent(expr ast.Expr, name string) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == name
+}
+
 // IsGinContextType checks if expr is *gin.Context
 func IsGinContextType(expr ast.Expr) bool {
 	starExpr, ok := expr.(*ast.StarExpr)
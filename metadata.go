@@ -0,0 +1,104 @@
+package alloy
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metadata sets a page's head metadata for a single request. Loaders set it with
+// SetMetadata or LoaderResult.WithMetadata, and it is merged over the page and engine defaults.
+type Metadata struct {
+	// Title replaces the page title when set.
+	Title string
+	// MetaTags replace the defaults with the same Name or Property and add the rest.
+	MetaTags []MetaTag
+	// Links are added after the defaults.
+	Links []Link
+	// Lang and Class replace the html element's lang and class attributes when set.
+	Lang  string
+	Class string
+	// JSONLD values are marshaled into <script type="application/ld+json"> blocks.
+	JSONLD []any
+}
+
+const metadataKey = "alloy.metadata"
+
+// SetMetadata merges meta into the metadata of the page rendered for c. Later calls
+// win, so a page's loader overrides the layouts' loaders that ran before it.
+func SetMetadata(c *gin.Context, meta Metadata) {
+	current := requestMetadata(c)
+	if meta.Title != "" {
+		current.Title = meta.Title
+	}
+	if meta.Lang != "" {
+		current.Lang = meta.Lang
+	}
+	if meta.Class != "" {
+		current.Class = meta.Class
+	}
+	current.MetaTags = mergeMetaTags(current.MetaTags, meta.MetaTags)
+	current.Links = append(current.Links, meta.Links...)
+	current.JSONLD = append(current.JSONLD, meta.JSONLD...)
+	c.Set(metadataKey, current)
+}
+
+func requestMetadata(c *gin.Context) Metadata {
+	meta, _ := c.Value(metadataKey).(Metadata)
+	return meta
+}
+
+// applyMetadata merges the metadata loaders set for c into data.
+func (data *DocumentData) applyMetadata(c *gin.Context) error {
+	meta := requestMetadata(c)
+	if meta.Title != "" {
+		data.Title = template.HTML(meta.Title)
+	}
+	if meta.Lang != "" {
+		data.Lang = template.HTML(meta.Lang)
+	}
+	if meta.Class != "" {
+		data.Class = template.HTML(meta.Class)
+	}
+	data.MetaTags = mergeMetaTags(data.MetaTags, meta.MetaTags)
+	data.Links = append(data.Links[:len(data.Links):len(data.Links)], meta.Links...)
+
+	for _, value := range meta.JSONLD {
+		// json.Marshal escapes <, > and &, so the block cannot close its script element.
+		jsonLD, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("marshal JSON-LD: %w", err)
+		}
+		data.JSONLD = append(data.JSONLD, template.JS(jsonLD))
+	}
+	return nil
+}
+
+// mergeMetaTags returns tags with each override replacing the tag with the same Name
+// or Property, and the other overrides appended.
+func mergeMetaTags(tags, overrides []MetaTag) []MetaTag {
+	if len(overrides) == 0 {
+		return tags
+	}
+	merged := make([]MetaTag, 0, len(tags)+len(overrides))
+	for _, tag := range tags {
+		if !overridden(tag, overrides) {
+			merged = append(merged, tag)
+		}
+	}
+	return append(merged, overrides...)
+}
+
+func overridden(tag MetaTag, overrides []MetaTag) bool {
+	for _, override := range overrides {
+		if tag.Name != "" && tag.Name == override.Name {
+			return true
+		}
+		if tag.Property != "" && tag.Property == override.Property {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package alloy
+
+import (
+	"encoding/json"
+	"html/template"
+)
+
+// PrefetchStrategy is when the client router prefetches the page a link points to.
+type PrefetchStrategy string
+
+const (
+	// PrefetchHover prefetches when the pointer hovers the link or it gets focus.
+	PrefetchHover PrefetchStrategy = "hover"
+	// PrefetchViewport prefetches when the link scrolls into view.
+	PrefetchViewport PrefetchStrategy = "viewport"
+	// PrefetchEager prefetches as soon as the link is rendered.
+	PrefetchEager PrefetchStrategy = "eager"
+	// PrefetchNone leaves loading to the click.
+	PrefetchNone PrefetchStrategy = "none"
+)
+
+// prefetchHeader asks a data endpoint for the page's bundle URLs only, without running
+// its loaders.
+const prefetchHeader = "X-Alloy-Prefetch"
+
+// prefetchConfig is the client router's prefetch configuration.
+type prefetchConfig struct {
+	Strategy PrefetchStrategy `json:"strategy"`
+	Data     bool             `json:"data"`
+}
+
+func (p *Page) prefetchScript() template.JS {
+	strategy := p.prefetch
+	if strategy == "" {
+		strategy = PrefetchHover
+	}
+	config, _ := json.Marshal(prefetchConfig{Strategy: strategy, Data: p.prefetchData})
+	return template.JS(config)
+}
@@ -0,0 +1,70 @@
+package alloy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bertilxi/alloy/core"
+	"github.com/gin-gonic/gin"
+)
+
+// Prerenderable reports whether the build renders the page's document ahead of time:
+// its route must be static, and neither it nor its layouts may have a loader unless it
+// opts in with Prerender.
+func (p *Page) Prerenderable() bool {
+	if strings.ContainsAny(p.Route, ":*") {
+		return false
+	}
+	if p.Prerender {
+		return true
+	}
+	for _, layout := range p.Layouts {
+		if layout.Loader != nil {
+			return false
+		}
+	}
+	return p.Loader == nil
+}
+
+// WritePrerendered renders the page's document and stores it next to its bundles, where
+// the production server picks it up instead of rendering per request.
+func (p *Page) WritePrerendered() error {
+	_, html, err := p.RenderStatic(nil)
+	if err != nil {
+		return err
+	}
+
+	file := core.PageCacheKey(p.File, "html")
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, html, 0644)
+}
+
+// handler returns the page's request handler: the prerendered document when the build
+// stored one and the server runs in production, otherwise Render.
+func (p *Page) handler() gin.HandlerFunc {
+	if core.IsDev() {
+		return p.Render
+	}
+
+	html, err := p.getBundleReader().ReadBundle(core.PageCacheKey(p.File, "html"))
+	if err != nil {
+		return p.Render
+	}
+
+	sum := sha256.Sum256(html)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "text/html")
+		c.Header("ETag", etag)
+		// ServeContent answers If-None-Match with 304 and handles HEAD and ranges.
+		http.ServeContent(c.Writer, c.Request, "", time.Time{}, bytes.NewReader(html))
+	}
+}
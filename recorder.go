@@ -0,0 +1,103 @@
+package alloy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// responseRecorder is a gin.ResponseWriter that buffers a response so it can be
+// replayed to other requests.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	wrote  bool
+}
+
+var _ gin.ResponseWriter = (*responseRecorder)(nil)
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: http.Header{}, status: http.StatusOK}
+}
+
+func (r *responseRecorder) Header() http.Header { return r.header }
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wrote {
+		r.status = status
+	}
+}
+
+func (r *responseRecorder) WriteHeaderNow() { r.wrote = true }
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.wrote = true
+	return r.body.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.wrote = true
+	return r.body.WriteString(s)
+}
+
+func (r *responseRecorder) Status() int { return r.status }
+
+func (r *responseRecorder) Size() int { return r.body.Len() }
+
+func (r *responseRecorder) Written() bool { return r.wrote }
+
+// Flush is a no-op: a recorded response is delivered in one piece.
+func (r *responseRecorder) Flush() {}
+
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("recorded responses cannot be hijacked")
+}
+
+func (r *responseRecorder) CloseNotify() <-chan bool { return make(chan bool) }
+
+func (r *responseRecorder) Pusher() http.Pusher { return nil }
+
+// result snapshots the recorded response.
+func (r *responseRecorder) result() *recordedResponse {
+	return &recordedResponse{
+		status: r.status,
+		header: r.header.Clone(),
+		body:   bytes.Clone(r.body.Bytes()),
+	}
+}
+
+// recordedResponse is a complete response captured by a responseRecorder.
+type recordedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+	// renderedFor is the request a shared render ran for, if any.
+	renderedFor *gin.Context
+}
+
+func (r *recordedResponse) writeTo(c *gin.Context) {
+	for key, values := range r.header {
+		c.Writer.Header()[key] = append([]string(nil), values...)
+	}
+	c.Status(r.status)
+	c.Writer.Write(r.body)
+}
+
+// recordingContext returns a copy of c whose response is buffered and whose request
+// is not cancelled with c's, so a render shared between requests completes for
+// whoever is still waiting.
+func recordingContext(c *gin.Context) (*gin.Context, *responseRecorder) {
+	recorder := newResponseRecorder()
+	rc := c.Copy()
+	rc.Request = c.Request.WithContext(context.WithoutCancel(c.Request.Context()))
+	rc.Writer = recorder
+	// The document is shared between visitors, so it must not carry this one's token.
+	delete(rc.Keys, csrfTokenKey)
+	return rc, recorder
+}
@@ -1,155 +1,143 @@
 package alloy
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 
-	"github.com/buke/quickjs-go"
-	"github.com/gin-gonic/gin"
 	"github.com/bertilxi/alloy/core"
+	"github.com/gin-gonic/gin"
 )
 
-type htmlTemplateData struct {
-	RenderedContent template.HTML
-	InitialProps    template.JS
-	JS              template.JS
-	CSS             template.CSS
-	Title           template.HTML
-	IsDev           bool
-	Hydrate         bool
-	RouteID         string
-	MetaTags        []MetaTag
-	Links           []Link
-	Lang            template.HTML
-	Class           template.HTML
-	WebSocketPort   string
-}
-
-const htmlTemplate = `<!DOCTYPE html>
-<html lang="{{.Lang}}" class="{{.Class}}">
-<head>
-    <meta charset="UTF-8">
-	<meta name="viewport" content="width=device-width, initial-scale=1.0" />
-    <title>{{.Title}}</title>
-	<link rel="icon" href="/.alloy/favicon.svg" type="image/svg+xml" />
-	<link rel="stylesheet" href="{{.CSS}}" />
-	{{range .MetaTags}}
-		<meta name="{{.Name}}" content="{{.Content}}" property="{{.Property}}" />
-	{{end}}
-	{{range .Links}}
-		<link rel="{{.Rel}}" href="{{.Href}}" />
-	{{end}}
-</head>
-<body>
-    <div id="page">{{.RenderedContent}}</div>
-	{{if .Hydrate}}
-	<script type="module" src="{{.JS}}"></script>
-	<script>window.PAGE_PROPS = {{.InitialProps}};</script>
-	{{end}}
-
-	{{if .IsDev}}
-	<script>
-      let reconnectAttempts = 0;
-      let reconnectDelay = 500;
-      const maxReconnectDelay = 5000;
-
-      function debounce(func, timeout = 500) {
-        let timer;
-        return (...args) => {
-          clearTimeout(timer);
-          timer = setTimeout(() => {
-            func.apply(this, args);
-          }, timeout);
-        };
-      }
-
-      const reload = debounce(() => {
-        console.log("reloading...");
-        window.location.reload(true);
-      });
-
-      let isFirstConnection = true;
-
-      function start() {
-        const wsPort = "{{.WebSocketPort}}" || window.location.port || "8080";
-        const wsUrl = "ws://" + window.location.hostname + ":" + wsPort + "/ws";
-        let socket = new WebSocket(wsUrl);
-
-        socket.onopen = () => {
-          // If reconnecting after a disconnect, reload the page
-          if (reconnectAttempts > 0) {
-            console.log("reconnected, reloading...");
-            reload();
-          }
-          reconnectAttempts = 0;
-          reconnectDelay = 500;
-          isFirstConnection = false;
-        };
-
-        socket.onmessage = reload;
-
-        socket.onerror = () => {
-          socket.close();
-        };
-
-        socket.onclose = () => {
-          socket = null;
-          reconnectAttempts++;
-          const delay = Math.min(reconnectDelay * Math.pow(1.5, reconnectAttempts), maxReconnectDelay);
-          setTimeout(start, delay);
-        };
-      }
-
-      start();
-	</script>
-	{{end}}
-</body>
-</html>`
-
-func (page *Page) ssr(props string) (string, error) {
-	bundle, err := page.getServerJsFromFs()
-	if err != nil {
-		return "", err
+func (page *Page) ssr(ctx context.Context, request core.RenderRequest) (core.RenderResult, error) {
+	ctx, cancel := page.renderContext(ctx)
+	defer cancel()
+
+	var result core.RenderResult
+	err := page.withRenderer(func(renderer core.Renderer) error {
+		var err error
+		result, err = renderer.Render(ctx, request)
+		return err
+	})
+	return result, err
+}
+
+// renderRequest builds the SSR request for c, tagging console output with the page and request ID.
+func (page *Page) renderRequest(c *gin.Context, jsonProps []byte) core.RenderRequest {
+	request := core.RenderRequest{Props: string(jsonProps), Context: page.ssrContext(c)}
+	if page.logger != nil {
+		request.Logger = page.logger.With(
+			"route", page.Route,
+			"file", page.File,
+			"request_id", requestID(c),
+		)
 	}
+	return request
+}
 
-	rt := quickjs.NewRuntime()
-	defer rt.Close()
-	ctx := rt.NewContext()
-	defer ctx.Close()
+// requestID returns the request's ID from the incoming or outgoing X-Request-ID header.
+func requestID(c *gin.Context) string {
+	if id := c.GetHeader("X-Request-ID"); id != "" {
+		return id
+	}
+	return c.Writer.Header().Get("X-Request-ID")
+}
 
-	res := ctx.Eval(bundle + "; renderPage(" + props + ")")
-	defer res.Free()
+// admittedKey is the gin context key set while the request holds a render slot.
+const admittedKey = "alloy.admitted"
 
-	return res.String(), nil
+// admit waits for a render slot when the engine bounds concurrent renders. A request
+// already holding one, e.g. rendering the error page of its failed render, keeps using it.
+func (page *Page) admit(c *gin.Context) (func(), error) {
+	if page.admission == nil || c.GetBool(admittedKey) {
+		return func() {}, nil
+	}
+	release, err := page.admission.Acquire(c.Request.Context())
+	if err != nil {
+		return nil, err
+	}
+	c.Set(admittedKey, true)
+	return func() {
+		c.Set(admittedKey, false)
+		release()
+	}, nil
 }
 
-func (p *Page) Render(c *gin.Context) {
-	errorHandler := p.ErrorHandler
-	props := p.Props
+// notAdmitted responds to a request that did not get a render slot, through the
+// SaturatedHandler when one is set.
+func (p *Page) notAdmitted(c *gin.Context, err error) {
+	if !errors.Is(err, core.ErrSaturated) {
+		// The client went away while queued.
+		c.Abort()
+		return
+	}
+	if p.saturatedHandler != nil {
+		p.saturatedHandler(c, p)
+		return
+	}
+	retryAfter := int(p.admission.RetryAfter().Seconds())
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error": "Server is busy, please retry",
+		"page":  p.Route,
+	})
+}
 
-	if p.Loader != nil {
-		loaderProps, err := p.Loader(c)
+// renderContext bounds a render by the page's RenderTimeout, on top of the request's own cancellation.
+func (page *Page) renderContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if page.RenderTimeout > 0 {
+		return context.WithTimeout(ctx, page.RenderTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// withRenderer runs fn against the page's renderer, retrying on a fresh pool
+// when a bundle cache clear invalidated it, and maps JS errors to original sources.
+func (page *Page) withRenderer(fn func(renderer core.Renderer) error) error {
+	for {
+		renderer, err := page.getRenderer()
 		if err != nil {
-			if errorHandler != nil {
-				errorHandler(c, err, p)
-			} else {
-				renderErr := &core.RenderError{
-					Step:    "loader execution",
-					Message: "Loader failed",
-					Details: err.Error(),
-				}
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error": renderErr.Error(),
-					"page":  p.Route,
-				})
-			}
-			return
+			return err
 		}
-		if loaderProps != nil {
-			props = loaderProps
+
+		err = fn(renderer)
+		if errors.Is(err, core.ErrPoolClosed) {
+			continue
+		}
+
+		var jsErr *core.JSError
+		if errors.As(err, &jsErr) {
+			page.mapJSError(jsErr)
 		}
+		return err
+	}
+}
+
+// Render handles a page request: it runs the loader, renders the page on the server
+// and writes the HTML document.
+func (p *Page) Render(c *gin.Context) {
+	if p.Cache != nil && p.pageStore != nil && !core.IsDev() {
+		p.renderCached(c)
+		return
+	}
+	if p.Coalesce != nil {
+		p.renderCoalesced(c)
+		return
+	}
+	p.render(c)
+}
+
+func (p *Page) render(c *gin.Context) {
+	errorHandler := p.ErrorHandler
+	props, ok := p.loadProps(c)
+	if !ok {
+		return
 	}
 
 	jsonProps, err := json.Marshal(props)
@@ -162,7 +150,7 @@ func (p *Page) Render(c *gin.Context) {
 		if errorHandler != nil {
 			errorHandler(c, renderErr, p)
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{
+			p.renderFailed(c, http.StatusInternalServerError, renderErr, gin.H{
 				"error": renderErr.Error(),
 				"page":  p.Route,
 			})
@@ -170,15 +158,32 @@ func (p *Page) Render(c *gin.Context) {
 		return
 	}
 
-	renderedHTML, err := p.ssr(string(jsonProps))
+	release, err := p.admit(c)
+	if err != nil {
+		p.notAdmitted(c, err)
+		return
+	}
+	defer release()
+
+	if p.Streaming {
+		p.renderStream(c, jsonProps)
+		return
+	}
+
+	rendered, err := p.ssr(c.Request.Context(), p.renderRequest(c, jsonProps))
+	if err != nil {
+		p.ssrFailed(c, err)
+		return
+	}
+
+	clientBundle, clientCSS, err := p.getClientJsFromFs()
 	if err != nil {
-		details := core.ExtractJSErrorContext(err.Error())
 		renderErr := &core.RenderError{
-			Step:    "server-side rendering",
-			Message: "React component rendering failed",
-			Details: details,
+			Step:    "bundle loading",
+			Message: "Client bundle files not found",
+			Details: fmt.Sprintf("Expected files for: %s", p.File),
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{
+		p.renderFailed(c, http.StatusInternalServerError, renderErr, gin.H{
 			"error": renderErr.Error(),
 			"page":  p.Route,
 			"file":  p.File,
@@ -186,39 +191,130 @@ func (p *Page) Render(c *gin.Context) {
 		return
 	}
 
-	clientBundle, clientCSS, err := p.getClientJsFromFs()
+	tmpl, err := p.documentTemplate(c.Request.Context())
 	if err != nil {
 		renderErr := &core.RenderError{
-			Step:    "bundle loading",
-			Message: "Client bundle files not found",
-			Details: fmt.Sprintf("Expected files for: %s", p.File),
+			Step:    "document rendering",
+			Message: "Failed to prepare the document shell",
+			Details: err.Error(),
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{
+		p.renderFailed(c, http.StatusInternalServerError, renderErr, gin.H{
+			"error": renderErr.Error(),
+		})
+		return
+	}
+
+	data, err := p.templateData(c, rendered, jsonProps, clientBundle, clientCSS)
+	if err != nil {
+		renderErr := &core.RenderError{
+			Step:    "metadata serialization",
+			Message: "Failed to convert page metadata to JSON",
+			Details: err.Error(),
+		}
+		p.renderFailed(c, http.StatusInternalServerError, renderErr, gin.H{
 			"error": renderErr.Error(),
 			"page":  p.Route,
-			"file":  p.File,
 		})
 		return
 	}
 
-	tmpl, err := template.New("webpage").Parse(htmlTemplate)
+	c.Header("Content-Type", "text/html")
+
+	err = tmpl.Execute(c.Writer, data)
+	if err != nil {
+		renderErr := &core.RenderError{
+			Step:    "template execution",
+			Message: "Failed to render HTML",
+			Details: err.Error(),
+		}
+		p.renderFailed(c, http.StatusInternalServerError, renderErr, gin.H{
+			"error": renderErr.Error(),
+		})
+		return
+	}
+}
+
+// layoutProps are the props of a page with layouts: the page's own props and each
+// layout's, outermost first. The generated entries hand each its share.
+type layoutProps struct {
+	Page    any   `json:"page"`
+	Layouts []any `json:"layouts"`
+}
+
+// loadProps runs the layout and page loaders for c and returns the props to render
+// with, including those the request's action added. It responds itself and reports
+// false when a loader fails or ends the request with a LoaderResult.
+func (p *Page) loadProps(c *gin.Context) (any, bool) {
+	var layouts []any
+	for _, layout := range p.Layouts {
+		var props any
+		if layout.Loader != nil {
+			var ok bool
+			if props, ok = p.runLoader(c, layout.Loader); !ok {
+				return nil, false
+			}
+		}
+		layouts = append(layouts, props)
+	}
+
+	props := p.Props
+	if p.Loader != nil {
+		loaderProps, ok := p.runLoader(c, p.Loader)
+		if !ok {
+			return nil, false
+		}
+		if loaderProps != nil {
+			props = loaderProps
+		}
+	}
+
+	props, err := withActionProps(c, props)
 	if err != nil {
 		renderErr := &core.RenderError{
-			Step:    "template parsing",
-			Message: "Internal template error",
+			Step:    "props serialization",
+			Message: "Failed to add the action's result to props",
 			Details: err.Error(),
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{
+		p.renderFailed(c, http.StatusInternalServerError, renderErr, gin.H{
 			"error": renderErr.Error(),
+			"page":  p.Route,
 		})
+		return nil, false
+	}
+
+	if len(p.Layouts) > 0 {
+		return layoutProps{Page: props, Layouts: layouts}, true
+	}
+	return props, true
+}
+
+// loaderFailed responds to a failed loader, through the ErrorHandler when one is set.
+func (p *Page) loaderFailed(c *gin.Context, err error) {
+	if p.ErrorHandler != nil {
+		p.ErrorHandler(c, err, p)
 		return
 	}
+	renderErr := &core.RenderError{
+		Step:    "loader execution",
+		Message: "Loader failed",
+		Details: err.Error(),
+	}
+	p.renderFailed(c, http.StatusInternalServerError, renderErr, gin.H{
+		"error": renderErr.Error(),
+		"page":  p.Route,
+	})
+}
 
-	data := htmlTemplateData{
-		RenderedContent: template.HTML(renderedHTML),
+// templateData builds the document data for c, with the metadata its loaders set
+// merged over the page's and the head elements its components declared over both.
+func (p *Page) templateData(c *gin.Context, rendered core.RenderResult, jsonProps []byte, clientBundle, clientCSS string) (DocumentData, error) {
+	data := DocumentData{
+		RenderedContent: template.HTML(rendered.HTML),
 		InitialProps:    template.JS(jsonProps),
 		JS:              template.JS(p.assetURL(clientBundle)),
+		Chunks:          p.chunkURLs(),
 		CSS:             template.CSS(p.assetURL(clientCSS)),
+		AppCSS:          p.appCSSURL(),
 		Title:           template.HTML(p.Title),
 		IsDev:           core.IsDev(),
 		RouteID:         p.File,
@@ -226,22 +322,102 @@ func (p *Page) Render(c *gin.Context) {
 		Links:           p.Links,
 		Lang:            template.HTML(p.Lang),
 		Class:           template.HTML(p.Class),
-		Hydrate:         p.Interactive,
+		Hydrate:         p.Interactive && !p.islands,
+		Islands:         p.islands,
+		Prefetch:        p.prefetchScript(),
+		Routes:          p.clientRoutes,
+		CSRF:            p.csrfScript(),
+		CSRFToken:       CSRFToken(c),
 		WebSocketPort:   "", // Will use window.location.port or 8080
 	}
+	err := data.applyMetadata(c)
+	data.setHead(rendered.Head)
+	return data, err
+}
 
-	c.Header("Content-Type", "text/html")
+// setHead places the markup of the page's Head elements in the document head. A
+// <title> among them replaces the page's.
+func (data *DocumentData) setHead(head string) {
+	data.Head = template.HTML(head)
+	if strings.Contains(head, "<title") {
+		data.Title = ""
+	}
+}
 
-	err = tmpl.Execute(c.Writer, data)
-	if err != nil {
-		renderErr := &core.RenderError{
-			Step:    "template execution",
-			Message: "Failed to render HTML",
-			Details: err.Error(),
+// chunkURLs returns the URLs of the shared chunks the page's client bundle imports.
+func (p *Page) chunkURLs() []template.JS {
+	chunks := p.getClientChunksFromFs()
+	urls := make([]template.JS, len(chunks))
+	for i, chunk := range chunks {
+		urls[i] = template.JS(p.assetURL(chunk))
+	}
+	return urls
+}
+
+func (p *Page) appCSSURL() template.CSS {
+	if appCSS := p.getAppCSSFromFs(); appCSS != "" {
+		return template.CSS(p.assetURL(appCSS))
+	}
+	return ""
+}
+
+// ssrFailed reports a server-side rendering failure with a 500 status, through the
+// ErrorHandler when one is set.
+func (p *Page) ssrFailed(c *gin.Context, err error) {
+	if errors.Is(err, context.Canceled) {
+		// The client went away; there is nobody left to respond to.
+		c.Abort()
+		return
+	}
+
+	details := core.ExtractJSErrorContext(err.Error())
+	var jsErr *core.JSError
+	if errors.As(err, &jsErr) {
+		if jsErr.Location != nil {
+			details += fmt.Sprintf(" (at %s)", jsErr.Location)
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": renderErr.Error(),
-		})
+		fmt.Fprintf(os.Stderr, "❌ SSR error in %s (%s)\n%s\n", p.Route, p.File, jsErr.Report())
+	}
+	renderErr := &core.RenderError{
+		Step:    "server-side rendering",
+		Message: "React component rendering failed",
+		Details: details,
+		Cause:   err,
+	}
+	switch {
+	case errors.Is(err, core.ErrRenderTimeout):
+		renderErr.Step = "render timeout"
+		renderErr.Message = "Rendering exceeded the time limit"
+		renderErr.Details = fmt.Sprintf("Render was interrupted after %s", p.RenderTimeout)
+		fmt.Fprintf(os.Stderr, "❌ SSR render timeout in %s (%s)\n", p.Route, p.File)
+	case errors.Is(err, core.ErrMemoryLimit):
+		renderErr.Step = "memory limit"
+		renderErr.Message = "Rendering exceeded the JS heap limit"
+		renderErr.Details = fmt.Sprintf("Heap limit is %d bytes", p.RenderMemoryLimit)
+		fmt.Fprintf(os.Stderr, "❌ SSR memory limit hit in %s (%s)\n", p.Route, p.File)
+	case errors.Is(err, core.ErrWorkerCrashed):
+		renderErr.Step = "worker crashed"
+		renderErr.Message = "The SSR worker process died during rendering"
+		renderErr.Details = err.Error()
+		fmt.Fprintf(os.Stderr, "❌ SSR worker crashed while rendering %s (%s)\n", p.Route, p.File)
+	}
+	c.Status(http.StatusInternalServerError)
+	if p.ErrorHandler != nil {
+		p.ErrorHandler(c, renderErr, p)
 		return
 	}
+	response := gin.H{
+		"error": renderErr.Error(),
+		"page":  p.Route,
+		"file":  p.File,
+	}
+	if jsErr != nil && core.IsDev() {
+		response["exception"] = jsErr.Error()
+		response["stack"] = jsErr.Stack
+		if jsErr.Location != nil {
+			response["location"] = jsErr.Location.String()
+			response["codeFrame"] = jsErr.CodeFrame
+		}
+	}
+	p.renderFailed(c, http.StatusInternalServerError, renderErr, response)
 }
@@ -1,10 +1,23 @@
 package alloy
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/bertilxi/alloy/core"
+	"github.com/gin-gonic/gin"
 )
 
 func BenchmarkBundleCache(b *testing.B) {
@@ -18,6 +31,26 @@ func BenchmarkBundleCache(b *testing.B) {
 	}
 }
 
+func BenchmarkSSRPool(b *testing.B) {
+	bundle := `globalThis.renderPage = function (props) { return "<h1>" + props.title + "</h1>"; }`
+	for _, engine := range core.JSEngines {
+		b.Run(engine.Name(), func(b *testing.B) {
+			pool, err := core.NewSSRPool("bench.ssr.js", bundle, core.SSRPoolOptions{Size: 4, Engine: engine})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer pool.Close()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					pool.Render(context.Background(), core.RenderRequest{Props: `{"title":"Test Page"}`})
+				}
+			})
+		})
+	}
+}
+
 func BenchmarkPropsMarshaling(b *testing.B) {
 	props := map[string]any{
 		"title":    "Test Page",
@@ -58,3 +91,877 @@ func BenchmarkAssetURL(b *testing.B) {
 		page.assetURL("bundle.js")
 	}
 }
+
+// setupTestPage writes bundles for pages/index.tsx into a temporary working directory.
+func setupTestPage(t *testing.T, serverBundle string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Chdir(t.TempDir())
+	for key, content := range map[string]string{
+		core.PageCacheKey("pages/index.tsx", "ssr.js"): serverBundle,
+		core.PageCacheKey("pages/index.tsx", "js"):     "",
+		core.PageCacheKey("pages/index.tsx", "css"):    "",
+	} {
+		if err := os.MkdirAll(filepath.Dir(key), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(key, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(ClearBundleCache)
+}
+
+func TestRenderCoalesced(t *testing.T) {
+	setupTestPage(t, `globalThis.renderPage = function (props) { return "<h1>" + props.n + "</h1>"; }`)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	page := Page{
+		Route: "/",
+		File:  "pages/index.tsx",
+		Loader: func(c *gin.Context) (any, error) {
+			<-release
+			return map[string]any{"n": calls.Add(1)}, nil
+		},
+		Coalesce: &CoalesceOptions{Query: []string{"v"}},
+	}
+	page.AssignOptions(Options{})
+
+	router := gin.New()
+	router.GET(page.Route, page.Render)
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 5)
+	for i := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// The ignored query parameter does not split the flight.
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/?v=1&ignored=%d", i), nil)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			bodies[i] = rec.Body.String()
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Fatalf("expected one loader call, got %d", calls.Load())
+	}
+	for _, body := range bodies {
+		if !strings.Contains(body, "<h1>1</h1>") {
+			t.Fatalf("unexpected body %q", body)
+		}
+	}
+}
+
+func TestRenderCoalescedCookies(t *testing.T) {
+	setupTestPage(t, `globalThis.renderPage = function (props) { return "<h1>" + props.n + "</h1>"; }`)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	page := Page{
+		Route: "/",
+		File:  "pages/index.tsx",
+		Loader: func(c *gin.Context) (any, error) {
+			<-release
+			n := calls.Add(1)
+			c.SetCookie("session", fmt.Sprint(n), 0, "/", "", false, true)
+			return map[string]any{"n": n}, nil
+		},
+		Coalesce: &CoalesceOptions{},
+	}
+	page.AssignOptions(Options{})
+
+	router := gin.New()
+	router.GET(page.Route, page.Render)
+
+	var wg sync.WaitGroup
+	cookies := make([]string, 3)
+	for i := range cookies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			cookies[i] = rec.Header().Get("Set-Cookie")
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// Responses setting cookies are not replayed to other requests.
+	seen := map[string]bool{}
+	for _, cookie := range cookies {
+		if cookie == "" || seen[cookie] {
+			t.Fatalf("expected a cookie of its own for every request, got %q", cookies)
+		}
+		seen[cookie] = true
+	}
+}
+
+func TestRenderCached(t *testing.T) {
+	setupTestPage(t, `globalThis.renderPage = function (props) { return "<h1>" + props.n + "</h1>"; }`)
+	core.SetProduction(true)
+	t.Cleanup(func() { core.SetProduction(false) })
+
+	var calls atomic.Int32
+	engine := New(Options{Router: gin.New()})
+	page := Page{
+		Route: "/",
+		File:  "pages/index.tsx",
+		Loader: func(c *gin.Context) (any, error) {
+			CacheTags(c, "counter")
+			return map[string]any{"n": calls.Add(1)}, nil
+		},
+		Cache: &CachePolicy{TTL: time.Minute},
+	}
+	page.AssignOptions(engine.Options)
+	engine.Router.GET(page.Route, page.Render)
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		engine.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec
+	}
+
+	for i, want := range []string{"MISS", "HIT"} {
+		rec := get()
+		if got := rec.Header().Get("X-Alloy-Cache"); got != want || !strings.Contains(rec.Body.String(), "<h1>1</h1>") {
+			t.Fatalf("request %d: got %s %q", i, got, rec.Body.String())
+		}
+	}
+
+	engine.PurgeTag("counter")
+	if rec := get(); !strings.Contains(rec.Body.String(), "<h1>2</h1>") {
+		t.Fatalf("expected a fresh render after purge, got %q", rec.Body.String())
+	}
+}
+
+func TestRenderStatic(t *testing.T) {
+	setupTestPage(t, `globalThis.renderPage = function (props) { return "<h1>" + props.slug + "</h1>"; }`)
+
+	page := Page{
+		Route: "/blog/:slug",
+		File:  "pages/index.tsx",
+		Loader: func(c *gin.Context) (any, error) {
+			return map[string]any{"slug": c.Param("slug")}, nil
+		},
+	}
+	page.AssignOptions(Options{
+		Paths: map[string]PathsFunc{
+			"/blog/:slug": func() ([]map[string]string, error) {
+				return []map[string]string{{"slug": "hello"}, {"slug": "a b"}}, nil
+			},
+		},
+	})
+
+	paramSets, err := page.StaticParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"/blog/hello": "<h1>hello</h1>", "/blog/a%20b": "<h1>a b</h1>"}
+	for _, params := range paramSets {
+		urlPath, html, err := page.RenderStatic(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(html), want[urlPath]) {
+			t.Fatalf("%s: unexpected document %q", urlPath, html)
+		}
+		delete(want, urlPath)
+	}
+	if len(want) > 0 {
+		t.Fatalf("missing documents %v", want)
+	}
+
+	page.Paths = nil
+	if _, err := page.StaticParams(); err == nil {
+		t.Fatal("expected an error for a dynamic route without paths")
+	}
+}
+
+func TestPrerendered(t *testing.T) {
+	setupTestPage(t, `globalThis.renderPage = function (props) { return "<h1>" + props.title + "</h1>"; }`)
+
+	page := Page{Route: "/", File: "pages/index.tsx", Props: map[string]any{"title": "static"}}
+	page.AssignOptions(Options{})
+	if !page.Prerenderable() {
+		t.Fatal("expected a loader-less page to be prerenderable")
+	}
+	if err := page.WritePrerendered(); err != nil {
+		t.Fatal(err)
+	}
+
+	core.SetProduction(true)
+	t.Cleanup(func() { core.SetProduction(false) })
+
+	page.Props = map[string]any{"title": "rendered"}
+	router := gin.New()
+	router.GET(page.Route, page.handler())
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" || !strings.Contains(rec.Body.String(), "<h1>static</h1>") {
+		t.Fatalf("expected the prerendered document, got %d %q %q", rec.Code, etag, rec.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for a matching ETag, got %d", rec.Code)
+	}
+}
+
+func TestRenderLayouts(t *testing.T) {
+	setupTestPage(t, `globalThis.renderPage = function (props) {
+		return "<main>" + props.layouts[0].site + "|" + JSON.stringify(props.layouts[1]) + "|" + props.page.title + "</main>";
+	}`)
+
+	page := Page{
+		Route:   "/",
+		File:    "pages/index.tsx",
+		Props:   map[string]any{"title": "home"},
+		Layouts: []Layout{{Route: "/", File: "pages/_layout.tsx"}, {Route: "/nested", File: "pages/nested/_layout.tsx"}},
+	}
+	page.AssignOptions(Options{
+		LayoutLoaders: map[string]PageLoader{
+			"/": func(c *gin.Context) (any, error) { return map[string]any{"site": "alloy"}, nil },
+		},
+	})
+	if page.Prerenderable() {
+		t.Fatal("a page whose layout has a loader is not prerenderable")
+	}
+
+	_, html, err := page.RenderStatic(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Layouts without a loader get null props.
+	if !strings.Contains(string(html), `<main>alloy|null|home</main>`) {
+		t.Fatalf("unexpected document %q", html)
+	}
+}
+
+func TestRenderDocument(t *testing.T) {
+	setupTestPage(t, `globalThis.renderPage = function (props) { return "<h1>" + props.title + "</h1>"; }`)
+
+	render := func(options Options) string {
+		t.Helper()
+		options.Router = gin.New()
+		engine := New(options)
+		page := Page{Route: "/", File: "pages/index.tsx", Props: map[string]any{"title": "home"}}
+		page.AssignOptions(engine.Options)
+		_, html, err := page.RenderStatic(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(html)
+	}
+
+	shell := template.Must(template.New("shell").Parse(
+		`<html><body data-shell="go">{{template "alloy.content" .}}{{template "alloy.scripts" .}}</body></html>`))
+	if html := render(Options{Document: shell}); !strings.Contains(html, `<body data-shell="go"><div id="page"><h1>home</h1></div>`) {
+		t.Fatalf("expected the Go document shell, got %q", html)
+	}
+
+	// A built _document.tsx places the slots where its placeholders are.
+	documentBundle := `globalThis.renderPage = function () {
+		return '<html lang="{{.Lang}}"><head><alloy-slot name="head"></alloy-slot>' +
+			'<script>window.CONFIG = {"theme":{"dark":true},"tpl":"{{.IsDev}}"};</script></head>' +
+			'<body data-shell="tsx"><alloy-slot name="content"></alloy-slot></body></html>';
+	}`
+	if err := os.WriteFile(core.PageCacheKey("pages/_document.tsx", "ssr.js"), []byte(documentBundle), 0644); err != nil {
+		t.Fatal(err)
+	}
+	html := render(Options{Title: "Docs"})
+	for _, want := range []string{
+		`<!DOCTYPE html><html lang="en">`,
+		`<title>Docs</title>`,
+		// Braces in the document's own markup are text, not template actions.
+		`<script>window.CONFIG = {"theme":{"dark":true},"tpl":"{{.IsDev}}"};</script>`,
+		`<body data-shell="tsx"><div id="page"><h1>home</h1></div></body>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Fatalf("expected %q in the _document.tsx shell, got %q", want, html)
+		}
+	}
+
+	// The rendered shell is kept until the bundle cache is cleared.
+	engine := New(Options{Router: gin.New()})
+	page := Page{Route: "/", File: "pages/index.tsx", Props: map[string]any{"title": "home"}}
+	page.AssignOptions(engine.Options)
+	shellOf := func() string {
+		t.Helper()
+		_, html, err := page.RenderStatic(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(html)
+	}
+	if html := shellOf(); !strings.Contains(html, `data-shell="tsx"`) {
+		t.Fatalf("expected the _document.tsx shell, got %q", html)
+	}
+	rebuilt := strings.ReplaceAll(documentBundle, `data-shell="tsx"`, `data-shell="rebuilt"`)
+	if err := os.WriteFile(core.PageCacheKey("pages/_document.tsx", "ssr.js"), []byte(rebuilt), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if html := shellOf(); !strings.Contains(html, `data-shell="tsx"`) {
+		t.Fatalf("expected the cached _document.tsx shell, got %q", html)
+	}
+	ClearBundleCache()
+	if html := shellOf(); !strings.Contains(html, `data-shell="rebuilt"`) {
+		t.Fatalf("expected the rebuilt _document.tsx shell, got %q", html)
+	}
+}
+
+func TestRenderAppStylesheet(t *testing.T) {
+	setupTestPage(t, `globalThis.renderPage = function (props) { return "<h1>app</h1>"; }`)
+
+	page := Page{Route: "/", File: "pages/index.tsx", App: "pages/_app.tsx"}
+	page.AssignOptions(Options{})
+
+	_, html, err := page.RenderStatic(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(html), "_app.css") {
+		t.Fatalf("expected no shared stylesheet before _app.tsx has CSS, got %q", html)
+	}
+
+	if err := os.WriteFile(core.PageCacheKey("pages/_app.tsx", "css"), []byte("body{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, html, err = page.RenderStatic(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(html), `<link rel="stylesheet" href="/.alloy/pages/_app.css" />`) {
+		t.Fatalf("expected the shared stylesheet link, got %q", html)
+	}
+}
+
+func TestRenderChunkPreloads(t *testing.T) {
+	setupTestPage(t, `globalThis.renderPage = function (props) { return "<h1>chunks</h1>"; }`)
+	manifest := `[".alloy/chunks/chunk-react.js",".alloy/chunks/chunk-runtime.js"]`
+	if err := os.WriteFile(core.PageCacheKey("pages/index.tsx", "chunks.json"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	page := Page{Route: "/", File: "pages/index.tsx", Interactive: true}
+	page.AssignOptions(Options{})
+
+	_, html, err := page.RenderStatic(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<link rel="modulepreload" href="/.alloy/pages/index.js" />`,
+		`<link rel="modulepreload" href="/.alloy/chunks/chunk-react.js" />`,
+		`<link rel="modulepreload" href="/.alloy/chunks/chunk-runtime.js" />`,
+	} {
+		if !strings.Contains(string(html), want) {
+			t.Errorf("expected %s in %q", want, html)
+		}
+	}
+}
+
+func TestErrorPages(t *testing.T) {
+	setupTestPage(t, `globalThis.renderPage = function (props) { return "<h1>index</h1>"; }`)
+	bundles := map[string]string{
+		"pages/404.tsx":    `globalThis.renderPage = function (props) { return "<h1>not found</h1>"; }`,
+		"pages/_error.tsx": `globalThis.renderPage = function (props) { return "<p>" + props.status + " " + props.message + " " + props.error.step + "</p>"; }`,
+	}
+	for file, bundle := range bundles {
+		for key, content := range map[string]string{
+			core.PageCacheKey(file, "ssr.js"): bundle,
+			core.PageCacheKey(file, "js"):     "",
+			core.PageCacheKey(file, "css"):    "",
+		} {
+			if err := os.WriteFile(key, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := os.MkdirAll("pages", 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"pages/index.tsx", "pages/404.tsx", "pages/_error.tsx"} {
+		if err := os.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	engine := New(Options{
+		Router:   gin.New(),
+		PagesDir: "pages",
+		Loaders: map[string]PageLoader{
+			"/": func(c *gin.Context) (any, error) { return nil, fmt.Errorf("database down") },
+		},
+	})
+	if err := engine.RegisterRoutes(); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		engine.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	// pages/404.tsx is no route of its own, so /404 is not found either.
+	for _, path := range []string{"/missing", "/404"} {
+		if rec := get(path); rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "<h1>not found</h1>") {
+			t.Fatalf("%s: expected the 404 page, got %d %q", path, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := get("/"); rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "<p>500 Internal Server Error loader execution</p>") {
+		t.Fatalf("expected the error page, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestErrorPageAdmission(t *testing.T) {
+	setupTestPage(t, `globalThis.renderPage = function (props) { throw new Error("boom"); }`)
+	for key, content := range map[string]string{
+		core.PageCacheKey("pages/_error.tsx", "ssr.js"): `globalThis.renderPage = function (props) { return "<p>" + props.status + "</p>"; }`,
+		core.PageCacheKey("pages/_error.tsx", "js"):     "",
+		core.PageCacheKey("pages/_error.tsx", "css"):    "",
+	} {
+		if err := os.WriteFile(key, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll("pages", 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"pages/index.tsx", "pages/_error.tsx"} {
+		if err := os.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The failed render's slot is the only one; the error page renders in it.
+	engine := New(Options{
+		Router:               gin.New(),
+		PagesDir:             "pages",
+		MaxConcurrentRenders: 1,
+	})
+	if err := engine.RegisterRoutes(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		engine.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "<p>500</p>") {
+			t.Fatalf("expected the error page, got %d %q", rec.Code, rec.Body.String())
+		}
+	}
+	if stats := engine.admission.Stats(); stats.InFlight != 0 {
+		t.Fatalf("expected the slot to be released, got %+v", stats)
+	}
+}
+
+func TestLoaderResults(t *testing.T) {
+	setupTestPage(t, `globalThis.renderPage = function (props) { return "<h1>" + props.n + "</h1>"; }`)
+
+	page := Page{
+		Route: "/",
+		File:  "pages/index.tsx",
+		Loader: func(c *gin.Context) (any, error) {
+			switch c.Query("r") {
+			case "redirect":
+				return Redirect(http.StatusFound, "/login").WithCookie(&http.Cookie{Name: "next", Value: "/"}), nil
+			case "bad-redirect":
+				return Redirect(http.StatusOK, "/login"), nil
+			case "gone":
+				return Status(http.StatusGone, map[string]any{"n": "gone"}).WithHeader("X-Reason", "removed"), nil
+			case "missing":
+				return nil, fmt.Errorf("lookup: %w", NotFound())
+			}
+			return map[string]any{"n": "ok"}, nil
+		},
+	}
+	page.AssignOptions(Options{})
+	page.notFoundPage = &Page{Route: "/404", File: "pages/index.tsx", Props: map[string]any{"n": "not found"}}
+	page.notFoundPage.AssignOptions(Options{})
+
+	router := gin.New()
+	router.GET("/", page.Render)
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?r="+query, nil))
+		return rec
+	}
+
+	rec := get("redirect")
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/login" || !strings.Contains(rec.Header().Get("Set-Cookie"), "next=/") {
+		t.Fatalf("expected a redirect with a cookie, got %d %v", rec.Code, rec.Header())
+	}
+
+	rec = get("bad-redirect")
+	if rec.Code != http.StatusInternalServerError || rec.Header().Get("Location") != "" || !strings.Contains(rec.Body.String(), "Invalid redirect status") {
+		t.Fatalf("expected a failed render for a redirect with status 200, got %d %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+
+	rec = get("gone")
+	if rec.Code != http.StatusGone || rec.Header().Get("X-Reason") != "removed" || !strings.Contains(rec.Body.String(), "<h1>gone</h1>") {
+		t.Fatalf("expected the page with status 410, got %d %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+
+	rec = get("missing")
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "<h1>not found</h1>") {
+		t.Fatalf("expected the 404 page, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRenderMetadata(t *testing.T) {
+	setupTestPage(t, `globalThis.renderPage = function (props) { return "<h1>" + props.title + "</h1>"; }`)
+
+	page := Page{
+		Route: "/",
+		File:  "pages/index.tsx",
+		Layouts: []Layout{{
+			Route: "/",
+			File:  "pages/_layout.tsx",
+			Loader: func(c *gin.Context) (any, error) {
+				SetMetadata(c, Metadata{Title: "Blog", Class: "blog"})
+				return nil, nil
+			},
+		}},
+		Loader: func(c *gin.Context) (any, error) {
+			post := map[string]any{"title": "Hello"}
+			return Props(post).WithMetadata(Metadata{
+				Title:    "Hello",
+				Lang:     "fr",
+				MetaTags: []MetaTag{{Name: "description", Content: "A post"}},
+				JSONLD:   []any{map[string]any{"@type": "BlogPosting", "headline": "</script>"}},
+			}), nil
+		},
+	}
+	page.AssignOptions(Options{
+		Title:    "Site",
+		MetaTags: []MetaTag{{Name: "description", Content: "The site"}},
+	})
+
+	router := gin.New()
+	router.GET("/", page.Render)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"<title>Hello</title>",
+		`<html lang="fr" class="blog">`,
+		`content="A post"`,
+		`<script type="application/ld+json">{"@type":"BlogPosting","headline":"\u003c/script\u003e"}</script>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in the document:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "The site") {
+		t.Errorf("expected the description to be overridden:\n%s", body)
+	}
+}
+
+func TestRenderHead(t *testing.T) {
+	setupTestPage(t, `globalThis.renderPage = function (props) {
+  return { html: "<h1>post</h1>", head: '<title data-alloy-head="title">Post</title>' };
+};
+globalThis.renderPageStream = function (props, write) {
+  write('<!--alloy:head--><title data-alloy-head="title">Post</title>');
+  write("<h1>post</h1>");
+  return Promise.resolve();
+};`)
+
+	for _, streaming := range []bool{false, true} {
+		page := Page{Route: "/", File: "pages/index.tsx", Streaming: streaming}
+		page.AssignOptions(Options{Title: "Site"})
+
+		router := gin.New()
+		router.GET("/", page.Render)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		body := rec.Body.String()
+		if !strings.Contains(body, `<title data-alloy-head="title">Post</title>`) || strings.Contains(body, "<title>Site</title>") {
+			t.Errorf("streaming=%v: expected the component's title to replace the page's:\n%s", streaming, body)
+		}
+		if !strings.Contains(body, `<div id="page"><h1>post</h1></div>`) {
+			t.Errorf("streaming=%v: expected the rendered page:\n%s", streaming, body)
+		}
+	}
+}
+
+func TestRenderStreamHead(t *testing.T) {
+	setupTestPage(t, `globalThis.renderPageStream = function (props, write) {
+  return Promise.reject(new Error("shell failed"));
+};`)
+
+	page := Page{Route: "/", File: "pages/index.tsx", Streaming: true, Interactive: true}
+	page.AssignOptions(Options{Title: "Site"})
+
+	router := gin.New()
+	router.GET("/", page.Render)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	// The head went out before rendering, so a failed shell still completes the document
+	// for the client to render.
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, `<link rel="modulepreload" href="/.alloy/pages/index.js" />`) || !strings.Contains(body, "<title>Site</title>") || !strings.Contains(body, "</html>") {
+		t.Fatalf("expected the complete document, got %d %q", rec.Code, body)
+	}
+	if strings.Index(body, "modulepreload") > strings.Index(body, "<title>") {
+		t.Errorf("expected the title after the flushed head:\n%s", body)
+	}
+}
+
+func TestPageData(t *testing.T) {
+	setupTestPage(t, `globalThis.renderPage = function (props) { return "<h1>" + props.slug + "</h1>"; }`)
+
+	page := Page{
+		Route: "/blog/:slug",
+		File:  "pages/index.tsx",
+		Loader: func(c *gin.Context) (any, error) {
+			SetMetadata(c, Metadata{Title: "Post " + c.Param("slug")})
+			return map[string]any{"slug": c.Param("slug")}, nil
+		},
+	}
+	page.AssignOptions(Options{Title: "Site"})
+
+	router := gin.New()
+	router.GET(dataRoute(page.Route), page.Data)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_alloy/data/blog/hello.json", nil))
+
+	want := `{"props":{"slug":"hello"},"module":"/.alloy/pages/index.js","css":"/.alloy/pages/index.css","title":"Post hello"}`
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != want {
+		t.Fatalf("expected the page data, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	dataPath, body, err := page.RenderStaticData(map[string]string{"slug": "hello"})
+	if err != nil || dataPath != "/_alloy/data/blog/hello.json" || strings.TrimSpace(string(body)) != want {
+		t.Fatalf("expected the static page data, got %s %s %v", dataPath, body, err)
+	}
+
+	if DataPath("/") != "/_alloy/data/index.json" {
+		t.Fatalf("unexpected data path for /: %s", DataPath("/"))
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	setupTestPage(t, `globalThis.renderPage = function (props) { return "<h1>home</h1>"; }`)
+
+	page := Page{
+		Route:       "/",
+		File:        "pages/index.tsx",
+		Interactive: true,
+		Loader: func(c *gin.Context) (any, error) {
+			t.Error("the loader must not run for an assets prefetch")
+			return nil, nil
+		},
+	}
+	page.AssignOptions(Options{Prefetch: PrefetchViewport, PrefetchData: true})
+
+	router := gin.New()
+	router.GET(dataRoute(page.Route), page.Data)
+	request := httptest.NewRequest(http.MethodGet, "/_alloy/data/index.json", nil)
+	request.Header.Set("X-Alloy-Prefetch", "assets")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, request)
+
+	want := `{"props":null,"module":"/.alloy/pages/index.js","css":"/.alloy/pages/index.css"}`
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != want {
+		t.Fatalf("expected the page's bundle URLs, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	page.Loader = nil
+	page.clientRoutes = clientRoutes([]Page{page, {Route: "/blog/:slug"}})
+	router.GET("/", page.Render)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`<link rel="modulepreload" href="/.alloy/pages/index.js" />`,
+		`window.ALLOY_PREFETCH = {"strategy":"viewport","data":true};`,
+		`window.ALLOY_ROUTES = ["/","/blog/:slug"];`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in the document:\n%s", want, body)
+		}
+	}
+}
+
+func TestActions(t *testing.T) {
+	setupTestPage(t, `globalThis.renderPage = function (props) {
+		return "<p>" + props.n + ":" + JSON.stringify(props.actionData || props.actionErrors || null) + "</p>";
+	}`)
+
+	page := Page{
+		Route: "/",
+		File:  "pages/index.tsx",
+		Loader: func(c *gin.Context) (any, error) {
+			return map[string]any{"n": 1}, nil
+		},
+		Action: func(c *gin.Context) (any, error) {
+			switch c.PostForm("email") {
+			case "":
+				return nil, Invalid(map[string]string{"email": "required"})
+			case "done":
+				return Redirect(http.StatusSeeOther, "/thanks"), nil
+			case "broken":
+				return nil, fmt.Errorf("database down")
+			}
+			return map[string]any{"saved": c.PostForm("email")}, nil
+		},
+	}
+	page.AssignOptions(Options{})
+
+	router := gin.New()
+	router.POST("/", page.Act)
+	post := func(email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("email="+email))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post("a@b.c")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `<p>1:{"saved":"a@b.c"}</p>`) {
+		t.Fatalf("expected the page with actionData, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = post("")
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), `<p>1:{"email":"required"}</p>`) {
+		t.Fatalf("expected the page with actionErrors and status 422, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = post("done")
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/thanks" {
+		t.Fatalf("expected a redirect, got %d %v", rec.Code, rec.Header())
+	}
+
+	rec = post("broken")
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "action execution") {
+		t.Fatalf("expected the action failure, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	setupTestPage(t, `globalThis.renderPage = function (props, context) {
+		return "<form><input name=\"" + context.csrf.field + "\" value=\"" + context.csrf.token + "\"></form>" + JSON.stringify((props || {}).actionData || null);
+	}`)
+
+	csrf := (&CSRFOptions{Exempt: []string{"/hook"}}).withDefaults()
+	page := Page{
+		Route:       "/",
+		File:        "pages/index.tsx",
+		Interactive: true,
+		Action: func(c *gin.Context) (any, error) {
+			return "saved", nil
+		},
+	}
+	page.AssignOptions(Options{CSRF: csrf})
+
+	router := gin.New()
+	router.GET("/", csrf.handlers("/", false, page.Render)...)
+	router.POST("/", csrf.handlers("/", true, page.Act)...)
+	router.POST("/hook", csrf.handlers("/hook", false, func(c *gin.Context) { c.Status(http.StatusNoContent) })...)
+	router.POST("/api/items", csrf.handlers("/api/items", false, func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusCreated, string(body))
+	})...)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "alloy_csrf" || cookies[0].Value == "" {
+		t.Fatalf("expected a token cookie, got %v", rec.Header())
+	}
+	token := cookies[0].Value
+	body := rec.Body.String()
+	if !strings.Contains(body, `<input name="_csrf" value="`+token+`">`) || !strings.Contains(body, `<meta name="csrf-token" content="`+token+`" />`) || !strings.Contains(body, `window.ALLOY_CSRF = {"cookie":"alloy_csrf","header":"X-CSRF-Token","field":"_csrf"};`) {
+		t.Fatalf("expected the token in the document, got %q", body)
+	}
+
+	post := func(path, form, header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: "alloy_csrf", Value: token})
+		if header != "" {
+			req.Header.Set("X-CSRF-Token", header)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post("/", "name=x", ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a post without token to be rejected, got %d", rec.Code)
+	}
+	if rec := post("/", "_csrf=forged", ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a post with a wrong token to be rejected, got %d", rec.Code)
+	}
+	if rec := post("/", "_csrf="+token, ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"saved"`) {
+		t.Fatalf("expected the action to run, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := post("/", "", token); rec.Code != http.StatusOK {
+		t.Fatalf("expected the header token to be accepted, got %d", rec.Code)
+	}
+	if rec := post("/hook", "", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected the exempt route to skip the check, got %d", rec.Code)
+	}
+
+	// API handlers only take the header, and read their bodies themselves.
+	if rec := post("/api/items", "_csrf="+token, ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected the form token to be rejected by an API handler, got %d", rec.Code)
+	}
+	if rec := post("/api/items", "_csrf="+token, token); rec.Code != http.StatusCreated || rec.Body.String() != "_csrf="+token {
+		t.Fatalf("expected the API handler to read its body, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestIslands(t *testing.T) {
+	setupTestPage(t, `globalThis.renderPage = function (props) {
+		return "<p>static</p><alloy-island data-src=\"/.alloy/islands/Counter.island.js\"><button>1</button></alloy-island>";
+	}`)
+
+	csrf := (&CSRFOptions{}).withDefaults()
+	page := Page{Route: "/", File: "pages/index.tsx", Interactive: true}
+	page.AssignOptions(Options{Islands: true, CSRF: csrf})
+
+	router := gin.New()
+	router.GET("/", csrf.handlers("/", false, page.Render)...)
+	router.GET(dataRoute(page.Route), page.Data)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	body := rec.Body.String()
+	if strings.Contains(body, "/.alloy/pages/index.js") || strings.Contains(body, "PAGE_PROPS") {
+		t.Fatalf("expected no page bundle in islands mode, got %q", body)
+	}
+	if !strings.Contains(body, `import(island.dataset.src)`) || !strings.Contains(body, `<alloy-island data-src="/.alloy/islands/Counter.island.js">`) {
+		t.Fatalf("expected the islands to load, got %q", body)
+	}
+	// Without the client router, the document itself sets up the CSRF token of forms.
+	if !strings.Contains(body, `window.ALLOY_CSRF = {"cookie":"alloy_csrf","header":"X-CSRF-Token","field":"_csrf"};`) || !strings.Contains(body, `document.addEventListener("submit"`) {
+		t.Fatalf("expected the CSRF configuration in islands mode, got %q", body)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, DataPath("/"), nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected the data endpoint to send the router to a full load, got %d", rec.Code)
+	}
+}
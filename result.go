@@ -0,0 +1,141 @@
+package alloy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bertilxi/alloy/core"
+	"github.com/gin-gonic/gin"
+)
+
+// LoaderResult lets a loader control the response instead of only supplying props.
+// Loaders return it in place of their props, e.g. return alloy.Redirect(http.StatusFound, "/login"), nil,
+// or as their error, e.g. return nil, alloy.NotFound(). Layout loaders can return it too.
+type LoaderResult struct {
+	status   int
+	location string
+	notFound bool
+	props    any
+	header   http.Header
+	cookies  []*http.Cookie
+	metadata *Metadata
+}
+
+// Redirect responds with a redirect to url. code is a 3xx status, e.g. http.StatusFound,
+// or http.StatusCreated; the render fails with any other.
+func Redirect(code int, url string) *LoaderResult {
+	return &LoaderResult{status: code, location: url}
+}
+
+// NotFound responds with 404 through pages/404.tsx when the project has one, then
+// pages/_error.tsx, otherwise JSON.
+func NotFound() *LoaderResult {
+	return &LoaderResult{status: http.StatusNotFound, notFound: true}
+}
+
+// Props renders the page with props, for attaching headers, cookies or metadata to them.
+func Props(props any) *LoaderResult {
+	return &LoaderResult{props: props}
+}
+
+// Status renders the page with props and responds with code, e.g. http.StatusGone.
+func Status(code int, props any) *LoaderResult {
+	return &LoaderResult{status: code, props: props}
+}
+
+// WithHeader adds a response header.
+func (r *LoaderResult) WithHeader(key, value string) *LoaderResult {
+	if r.header == nil {
+		r.header = http.Header{}
+	}
+	r.header.Add(key, value)
+	return r
+}
+
+// WithCookie adds a Set-Cookie response header.
+func (r *LoaderResult) WithCookie(cookie *http.Cookie) *LoaderResult {
+	r.cookies = append(r.cookies, cookie)
+	return r
+}
+
+// WithMetadata sets the page's head metadata for the request, as SetMetadata does.
+func (r *LoaderResult) WithMetadata(meta Metadata) *LoaderResult {
+	r.metadata = &meta
+	return r
+}
+
+func (r *LoaderResult) Error() string {
+	switch {
+	case r.location != "":
+		return fmt.Sprintf("redirect %d to %s", r.status, r.location)
+	case r.notFound:
+		return "not found"
+	case r.status != 0:
+		return fmt.Sprintf("status %d", r.status)
+	default:
+		return "props"
+	}
+}
+
+// runLoader runs loader for c and returns its props. It responds itself and reports
+// false when the loader fails or its LoaderResult ends the request.
+func (p *Page) runLoader(c *gin.Context, loader PageLoader) (any, bool) {
+	props, err := loader(c)
+	result, _ := props.(*LoaderResult)
+	if err != nil && !errors.As(err, &result) {
+		p.loaderFailed(c, err)
+		return nil, false
+	}
+	if result == nil {
+		return props, true
+	}
+	return result.respond(c, p)
+}
+
+// respond applies the result's headers, cookies and metadata to c, then either ends
+// the request or sets the status and returns the props to render with.
+func (r *LoaderResult) respond(c *gin.Context, p *Page) (any, bool) {
+	if r.location != "" && !redirectStatus(r.status) {
+		renderErr := &core.RenderError{
+			Step:    "loader result",
+			Message: "Invalid redirect status",
+			Details: fmt.Sprintf("status %d redirecting to %s is not a 3xx or 201", r.status, r.location),
+		}
+		p.renderFailed(c, http.StatusInternalServerError, renderErr, gin.H{
+			"error": renderErr.Error(),
+			"page":  p.Route,
+		})
+		return nil, false
+	}
+
+	for key, values := range r.header {
+		for _, value := range values {
+			c.Writer.Header().Add(key, value)
+		}
+	}
+	for _, cookie := range r.cookies {
+		http.SetCookie(c.Writer, cookie)
+	}
+	if r.metadata != nil {
+		SetMetadata(c, *r.metadata)
+	}
+
+	switch {
+	case r.location != "":
+		c.Redirect(r.status, r.location)
+		return nil, false
+	case r.notFound:
+		p.notFound(c)
+		return nil, false
+	}
+	if r.status != 0 {
+		c.Status(r.status)
+	}
+	return r.props, true
+}
+
+// redirectStatus reports whether gin can redirect with status.
+func redirectStatus(status int) bool {
+	return (status >= http.StatusMultipleChoices && status <= http.StatusPermanentRedirect) || status == http.StatusCreated
+}
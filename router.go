@@ -17,6 +17,11 @@ func DiscoverPages(pagesDir string, loaders map[string]PageLoader) ([]Page, erro
 			Route:       pf.Route,
 			File:        pf.File,
 			Interactive: true,
+			App:         pf.App,
+		}
+
+		for _, layout := range pf.Layouts {
+			page.Layouts = append(page.Layouts, Layout{Route: layout.Route, File: layout.File})
 		}
 
 		if loaders != nil {
@@ -28,5 +33,44 @@ func DiscoverPages(pagesDir string, loaders map[string]PageLoader) ([]Page, erro
 		pages[i] = page
 	}
 
+	routes := clientRoutes(pages)
+	for i := range pages {
+		pages[i].clientRoutes = routes
+	}
+
 	return pages, nil
 }
+
+// DiscoverNotFoundPage returns the project's pages/404.tsx with its loader, or nil if it has none.
+func DiscoverNotFoundPage(pagesDir string, loaders map[string]PageLoader) *Page {
+	pf, ok := core.DiscoverNotFoundPageFile(pagesDir)
+	if !ok {
+		return nil
+	}
+	page := &Page{
+		Route:       pf.Route,
+		File:        pf.File,
+		Interactive: true,
+		App:         pf.App,
+		Loader:      loaders[pf.Route],
+	}
+	for _, layout := range pf.Layouts {
+		page.Layouts = append(page.Layouts, Layout{Route: layout.Route, File: layout.File})
+	}
+	return page
+}
+
+// DiscoverErrorPage returns the project's pages/_error.tsx with its loader, or nil if it has none.
+func DiscoverErrorPage(pagesDir string, loaders map[string]PageLoader) *Page {
+	pf, ok := core.DiscoverErrorPageFile(pagesDir)
+	if !ok {
+		return nil
+	}
+	return &Page{
+		Route:       pf.Route,
+		File:        pf.File,
+		Interactive: true,
+		App:         pf.App,
+		Loader:      loaders[pf.Route],
+	}
+}
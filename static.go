@@ -0,0 +1,100 @@
+package alloy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StaticParams lists the route params of every document the page produces on static
+// export: a single empty set for static routes, or the sets returned by Paths.
+func (p *Page) StaticParams() ([]map[string]string, error) {
+	if !strings.ContainsAny(p.Route, ":*") {
+		return []map[string]string{{}}, nil
+	}
+	if p.Paths == nil {
+		return nil, fmt.Errorf("dynamic route %s has no paths function", p.Route)
+	}
+
+	paramSets, err := p.Paths()
+	if err != nil {
+		return nil, fmt.Errorf("paths for %s: %w", p.Route, err)
+	}
+	return paramSets, nil
+}
+
+// RenderStatic renders the page's document for params as a GET request would, and
+// returns it with its URL path. It fails unless the page responds with 200.
+func (p *Page) RenderStatic(params map[string]string) (string, []byte, error) {
+	urlPath, err := expandRoute(p.Route, params)
+	if err != nil {
+		return "", nil, err
+	}
+	body, err := p.serveStatic(urlPath, params, http.StatusOK, p.render)
+	return urlPath, body, err
+}
+
+// RenderStaticNotFound renders the page as the document static hosts serve for unknown
+// paths, e.g. pages/404.tsx as 404.html. It fails unless the page responds with 404.
+func (p *Page) RenderStaticNotFound() ([]byte, error) {
+	return p.serveStatic(p.Route, nil, http.StatusNotFound, func(c *gin.Context) {
+		c.Status(http.StatusNotFound)
+		p.render(c)
+	})
+}
+
+// RenderStaticData renders the page's data endpoint payload for params, for client-side
+// navigation on a static host, and returns it with the endpoint's URL path.
+func (p *Page) RenderStaticData(params map[string]string) (string, []byte, error) {
+	urlPath, err := expandRoute(p.Route, params)
+	if err != nil {
+		return "", nil, err
+	}
+	dataPath := DataPath(urlPath)
+	body, err := p.serveStatic(dataPath, params, http.StatusOK, p.data)
+	return dataPath, body, err
+}
+
+// serveStatic runs handler for a GET request of urlPath with params and returns the
+// response body. It fails unless the handler responds with status.
+func (p *Page) serveStatic(urlPath string, params map[string]string, status int, handler gin.HandlerFunc) ([]byte, error) {
+	request, err := http.NewRequest(http.MethodGet, urlPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	recorder := newResponseRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Writer = recorder
+	c.Request = request
+	for key, value := range params {
+		c.Params = append(c.Params, gin.Param{Key: key, Value: value})
+	}
+
+	handler(c)
+
+	response := recorder.result()
+	if response.status != status {
+		return nil, fmt.Errorf("render %s: status %d: %s", urlPath, response.status, response.body)
+	}
+	return response.body, nil
+}
+
+// expandRoute fills route's :param and *param segments from params.
+func expandRoute(route string, params map[string]string) (string, error) {
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, ":") && !strings.HasPrefix(segment, "*") {
+			continue
+		}
+		value, ok := params[segment[1:]]
+		if !ok {
+			return "", fmt.Errorf("paths for %s: missing param %q in %v", route, segment[1:], params)
+		}
+		segments[i] = url.PathEscape(value)
+	}
+	return strings.Join(segments, "/"), nil
+}
@@ -0,0 +1,161 @@
+package alloy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/bertilxi/alloy/core"
+	"github.com/gin-gonic/gin"
+)
+
+// streamMarker stands in for the rendered content when splitting the document
+// into the part flushed before React's stream and the part written after it.
+const streamMarker = "<!--alloy:stream-->"
+
+// headChunkPrefix marks the first chunk of a streamed render, which carries the markup
+// of the shell's Head elements rather than page content.
+const headChunkPrefix = "<!--alloy:head-->"
+
+// headMarker stands in for the title and Head elements when splitting the document
+// head into the part flushed before rendering and the part written with the shell.
+const headMarker template.HTML = "<!--alloy:head-elements-->"
+
+func (page *Page) ssrStream(ctx context.Context, request core.RenderRequest, write func(chunk []byte) error) error {
+	ctx, cancel := page.renderContext(ctx)
+	defer cancel()
+
+	return page.withRenderer(func(renderer core.Renderer) error {
+		return renderer.RenderStream(ctx, request, write)
+	})
+}
+
+// renderStream renders the page with renderToReadableStream. The document head is
+// flushed before rendering starts, so the browser fetches stylesheets and modules
+// meanwhile; the title and Head elements follow once React produces the shell, then
+// the shell and each resolved Suspense boundary as they arrive. The status is sent
+// with the head, so render errors leave the page to the client instead of a 500.
+func (p *Page) renderStream(c *gin.Context, jsonProps []byte) {
+	clientBundle, clientCSS, err := p.getClientJsFromFs()
+	if err != nil {
+		renderErr := &core.RenderError{
+			Step:    "bundle loading",
+			Message: "Client bundle files not found",
+			Details: fmt.Sprintf("Expected files for: %s", p.File),
+		}
+		p.renderFailed(c, http.StatusInternalServerError, renderErr, gin.H{
+			"error": renderErr.Error(),
+			"page":  p.Route,
+			"file":  p.File,
+		})
+		return
+	}
+
+	tmpl, err := p.documentTemplate(c.Request.Context())
+	if err != nil {
+		renderErr := &core.RenderError{
+			Step:    "document rendering",
+			Message: "Failed to prepare the document shell",
+			Details: err.Error(),
+		}
+		p.renderFailed(c, http.StatusInternalServerError, renderErr, gin.H{
+			"error": renderErr.Error(),
+		})
+		return
+	}
+
+	data, err := p.templateData(c, core.RenderResult{HTML: streamMarker}, jsonProps, clientBundle, clientCSS)
+	if err != nil {
+		renderErr := &core.RenderError{
+			Step:    "metadata serialization",
+			Message: "Failed to convert page metadata to JSON",
+			Details: err.Error(),
+		}
+		p.renderFailed(c, http.StatusInternalServerError, renderErr, gin.H{
+			"error": renderErr.Error(),
+			"page":  p.Route,
+		})
+		return
+	}
+
+	// The title waits for the shell, whose Heads may replace it.
+	title := data.Title
+	data.Title, data.Head = "", headMarker
+	var document bytes.Buffer
+	if err := tmpl.Execute(&document, data); err != nil {
+		renderErr := &core.RenderError{
+			Step:    "template execution",
+			Message: "Failed to render HTML",
+			Details: err.Error(),
+		}
+		p.renderFailed(c, http.StatusInternalServerError, renderErr, gin.H{
+			"error": renderErr.Error(),
+		})
+		return
+	}
+	data.Title, data.Head = title, ""
+	head, rest, _ := strings.Cut(document.String(), string(headMarker))
+	headEnd, tail, _ := strings.Cut(rest, streamMarker)
+
+	// The status stays whatever was set before rendering, e.g. 404 for pages/404.tsx.
+	c.Header("Content-Type", "text/html")
+	if _, err := io.WriteString(c.Writer, head); err != nil {
+		return
+	}
+	c.Writer.Flush()
+
+	started := false
+	start := func() error {
+		started = true
+		var title bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&title, "alloy.title", data); err != nil {
+			return err
+		}
+		title.WriteString(headEnd)
+		_, err := c.Writer.Write(title.Bytes())
+		return err
+	}
+
+	err = p.ssrStream(c.Request.Context(), p.renderRequest(c, jsonProps), func(chunk []byte) error {
+		if !started {
+			if markup, ok := bytes.CutPrefix(chunk, []byte(headChunkPrefix)); ok {
+				data.setHead(string(markup))
+				chunk = nil
+			}
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if len(chunk) > 0 {
+			if _, err := c.Writer.Write(chunk); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	})
+
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if err != nil {
+		// The status is already sent; finish the document so the client can take over rendering.
+		var jsErr *core.JSError
+		if errors.As(err, &jsErr) {
+			err = errors.New(jsErr.Report())
+		}
+		fmt.Fprintf(os.Stderr, "❌ SSR stream error in %s (%s)\n%v\n", p.Route, p.File, err)
+	}
+	if !started {
+		if err := start(); err != nil {
+			return
+		}
+	}
+	io.WriteString(c.Writer, tail)
+}
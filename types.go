@@ -3,8 +3,12 @@ package alloy
 import (
 	"embed"
 	"html/template"
+	"log/slog"
+	"time"
 
+	"github.com/bertilxi/alloy/core"
 	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/singleflight"
 )
 
 // MetaTag defines SEO metadata for pages. Values are sanitized for HTML templates.
@@ -25,6 +29,7 @@ type Page struct {
 	Route        string
 	File         string
 	Interactive  bool
+	Streaming    bool
 	Props        any
 	Title        string
 	MetaTags     []MetaTag
@@ -33,17 +38,78 @@ type Page struct {
 	Class        string
 	Loader       PageLoader
 	ErrorHandler ErrorHandler
-	embedFS      *embed.FS
+	// Layouts wrap the page, outermost first.
+	Layouts []Layout
+	// App is the project's _app.tsx wrapping the page, empty if it has none.
+	App string
+	// RenderTimeout and RenderMemoryLimit override the engine-wide render limits for this page.
+	RenderTimeout     time.Duration
+	RenderMemoryLimit uint64
+	// Coalesce shares one loader and SSR execution among concurrent identical requests.
+	Coalesce *CoalesceOptions
+	// Cache serves rendered documents from the engine's PageStore.
+	Cache *CachePolicy
+	// Paths lists the route params of every document to generate for a dynamic route on static export.
+	Paths PathsFunc
+	// Action handles form POSTs to the page's route.
+	Action PageAction
+	// Prerender renders the page once at build time even though it has a loader.
+	// Pages with a static route and no loader are always prerendered.
+	Prerender bool
+
+	// islands hydrates only the page's client islands. It is app-wide, set from Options.Islands.
+	islands          bool
+	embedFS          *embed.FS
+	logger           *slog.Logger
+	jsEngine         core.JSEngine
+	ssrWorkers       *core.SSRWorkerPool
+	ssrPoolSize      int
+	admission        *core.Admission
+	saturatedHandler SaturatedHandler
+	flights          *singleflight.Group
+	pageStore        core.PageStore
+	document         *document
+	errorPage        *Page
+	notFoundPage     *Page
+	prefetch         PrefetchStrategy
+	prefetchData     bool
+	clientRoutes     template.JS
+	csrf             *CSRFOptions
+}
+
+// Layout is a _layout.tsx file wrapping every page in its directory and below.
+type Layout struct {
+	// Route is the route of the layout's directory, e.g. "/blog".
+	Route string
+	File  string
+	// Loader loads props passed only to this layout.
+	Loader PageLoader
 }
 
 // ErrorHandler is a framework-specific callback for rendering errors.
 // Receives Gin context for framework-specific handling.
 type ErrorHandler func(c *gin.Context, err error, page *Page)
 
+// SaturatedHandler responds to a request whose render was not admitted because
+// MaxConcurrentRenders and the render queue are full.
+type SaturatedHandler func(c *gin.Context, page *Page)
+
 // PageLoader loads data for a page's SSR, returning props for the React component.
+// Returning a *LoaderResult, e.g. from Redirect, NotFound or Status, controls the response.
 // Signature: func(c *gin.Context) (props any, err error)
 type PageLoader func(c *gin.Context) (any, error)
 
+// PageAction handles a form POST to its page's route. The page is re-rendered with the
+// returned data as its actionData prop, unless a *LoaderResult, e.g. from Redirect, ends
+// the request. Returning an *ActionError re-renders it with validation errors instead.
+// Signature: func(c *gin.Context) (data any, err error)
+type PageAction func(c *gin.Context) (any, error)
+
+// PathsFunc lists the route params of each document a dynamic route produces on static
+// export, e.g. [{"slug": "hello"}, {"slug": "world"}] for /blog/:slug.
+// Signature: func() ([]map[string]string, error)
+type PathsFunc func() ([]map[string]string, error)
+
 // Options configures the Alloy engine.
 type Options struct {
 	Router       *gin.Engine
@@ -54,10 +120,78 @@ type Options struct {
 	PagesDir     string
 	Loaders      map[string]PageLoader
 	Handlers     map[string]gin.HandlerFunc
+	Paths        map[string]PathsFunc
 	Lang         string
 	Class        string
 	Port         string
 	ErrorHandler ErrorHandler
+	// Streaming renders every page with React's streaming renderer. Pages can also opt in individually.
+	Streaming bool
+	// SSRPoolSize bounds the warmed JS runtimes kept per page. Defaults to GOMAXPROCS.
+	SSRPoolSize int
+	// RenderTimeout interrupts a server render that runs longer than this. Zero disables it.
+	RenderTimeout time.Duration
+	// RenderMemoryLimit caps each JS runtime's heap in bytes. Zero means unlimited.
+	RenderMemoryLimit uint64
+	// Logger receives console output from server bundles. Defaults to a pretty stderr
+	// logger in development and a JSON logger filtered by LogLevel in production.
+	Logger *slog.Logger
+	// LogLevel is the minimum level of forwarded console output in production.
+	LogLevel slog.Level
+	// JSEngine runs server bundles. Defaults to core.QuickJS, or core.Goja in builds
+	// without cgo.
+	JSEngine core.JSEngine
+	// SSRWorkers renders in this many child processes instead of in the server process,
+	// so an engine crash or leak only takes down a worker. Workers re-execute the binary
+	// and take over in New, before any of the application's later setup runs. Production only.
+	SSRWorkers int
+	// SSRWorkerMaxRenders restarts a worker process after this many renders. Zero never recycles.
+	SSRWorkerMaxRenders int
+	// MaxConcurrentRenders bounds server renders running at once across all pages. Zero is unbounded.
+	MaxConcurrentRenders int
+	// RenderQueueSize is how many renders may wait for a slot once MaxConcurrentRenders is reached.
+	RenderQueueSize int
+	// RenderQueueTimeout bounds the wait for a slot. Zero waits as long as the request lives.
+	RenderQueueTimeout time.Duration
+	// SaturatedHandler responds when a render is not admitted. Defaults to a 503 with Retry-After.
+	SaturatedHandler SaturatedHandler
+	// PageStore keeps documents of pages with a Cache policy. Defaults to an in-memory LRU.
+	PageStore core.PageStore
+	// LayoutLoaders maps layout directory routes, e.g. "/blog", to the loaders of their
+	// _layout.tsx files.
+	LayoutLoaders map[string]PageLoader
+	// Prerender lists routes rendered once at build time even though they have a loader.
+	// The loader then sees a synthetic GET request.
+	Prerender []string
+	// Document replaces the HTML shell pages are rendered into. It is executed with
+	// DocumentData and places the page with the slots {{template "alloy.head" .}},
+	// "alloy.content", "alloy.scripts" and "alloy.devReload". Without it, a
+	// _document.tsx at the root of PagesDir is used if present.
+	Document *template.Template
+	// Prefetch is when the client router prefetches the bundles of linked pages. Defaults
+	// to PrefetchHover. Links override it with a data-alloy-prefetch attribute, or the
+	// prefetch prop of the runtime's Link.
+	Prefetch PrefetchStrategy
+	// PrefetchData also prefetches linked pages' loader data, which navigation then uses
+	// if it is at most 30 seconds old.
+	PrefetchData bool
+	// Actions maps page routes to the actions handling form POSTs to them.
+	Actions map[string]PageAction
+	// Islands renders every page in islands mode: only .island.tsx components hydrate,
+	// and the rest of the page ships no JavaScript. The mode is app-wide, with no
+	// per-page opt-in: every page gets the inline script loading its islands' entries,
+	// and with CSRF on the one adding the token to posted forms, even if it renders no
+	// islands.
+	Islands bool
+	// CSRF checks a token on every unsafe request to page actions and API handlers.
+	// Nil disables protection.
+	CSRF *CSRFOptions
+
+	ssrWorkers   *core.SSRWorkerPool
+	admission    *core.Admission
+	document     *document
+	errorPage    *Page
+	notFoundPage *Page
 }
 
 // Engine manages routing, page discovery, and rendering.